@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cdop.pt/go/free/platepipe/collections"
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/documents/files"
+)
+
+func isDirectory(filePath string) bool {
+	info, err := os.Stat(filePath)
+	return err == nil && info.IsDir()
+}
+
+// findDocuments returns the paths of the Markdown, HTML and text documents
+// under dir, in lexical order, leaving out hidden files and directories, and
+// the output directory.
+func findDocuments(dir, output string) []string {
+	absOutput, _ := filepath.Abs(output)
+
+	ret := []string{}
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if abs, _ := filepath.Abs(p); abs == absOutput {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if files.HasKnownMarkdownExt(p) || files.HasKnownHTMLExt(p) ||
+			strings.EqualFold(filepath.Ext(p), ".txt") {
+			ret = append(ret, p)
+		}
+
+		return nil
+	})
+	if err != nil {
+		failAt(-1, "error finding documents",
+			diagnostics.New(diagnostics.KindIO, dir, err))
+	}
+
+	return ret
+}
+
+// documentURL returns the URL of a document, given information about its
+// file, as given by the "url" key of its header, or generated from its path
+// relative to the input root, see collections.URL, or an empty string for
+// standard input.
+func documentURL(doc *document, info map[string]any) string {
+	if url, ok := doc.data["url"].(string); ok {
+		return url
+	}
+
+	if rel, ok := info["relative"].(string); ok {
+		return collections.URL(rel)
+	}
+
+	return ""
+}
+
+// declares reports whether the header of the document, or of any template in
+// the chain, defines key.
+func declares(doc *document, c *chain, key string) bool {
+	if _, ok := doc.data[key]; ok {
+		return true
+	}
+
+	for _, m := range c.metadata {
+		if _, ok := m[key]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// paginate returns the paginators of the pages of the document with the
+// given URL, if data declares a pagination, see collections.Pagination, or a
+// single nil paginator otherwise.
+func paginate(data map[string]any, url string) []map[string]any {
+	p, err := collections.ParsePagination(data)
+	if err == nil && p == nil {
+		return []map[string]any{nil}
+	}
+
+	var pages []map[string]any
+
+	if err == nil {
+		cs, _ := data["collections"].(map[string]any)
+		pages, err = p.Pages(cs, url)
+	}
+
+	if err != nil {
+		failAt(-1, "error paginating document",
+			diagnostics.New(diagnostics.KindMetadata, "", err))
+	}
+
+	return pages
+}
+
+// createOutput creates the file of the page with the given URL in the output
+// directory, and its directory, as needed. Pages with URLs ending with a
+// slash are written to index.html files.
+func createOutput(output, url string) *os.File {
+	rel := strings.TrimPrefix(path.Clean("/"+url), "/")
+	if rel == "" || strings.HasSuffix(url, "/") {
+		rel = path.Join(rel, "index.html")
+	}
+
+	filePath := filepath.Join(output, filepath.FromSlash(rel))
+
+	err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		failAt(-1, "error creating output",
+			diagnostics.New(diagnostics.KindIO, filePath, err))
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		failAt(-1, "error creating output",
+			diagnostics.New(diagnostics.KindIO, filePath, err))
+	}
+
+	return f
+}
+
+func closeOutput(f *os.File) {
+	err := f.Close()
+	if err != nil {
+		failAt(-1, "error writing output",
+			diagnostics.New(diagnostics.KindIO, f.Name(), err))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"cdop.pt/go/free/platepipe/documents/files"
+	"cdop.pt/go/free/platepipe/templates"
+)
+
+// configureClock fixes the time of the pipeline, .platepipe.time and the
+// result of the now template function, to the time given by the -time option
+// or, if not set, by SOURCE_DATE_EPOCH, as defined by the Reproducible Builds
+// project, so that the output only depends on the input. Later modification
+// times of files are clamped to it, see files.Epoch.
+func configureClock(opts *options) {
+	value, name, parse := opts.time, "-time", parseTime
+	if value == "" {
+		value, name, parse = os.Getenv("SOURCE_DATE_EPOCH"),
+			"SOURCE_DATE_EPOCH", parseEpoch
+	}
+	if value == "" {
+		return
+	}
+
+	t, err := parse(value)
+	if err != nil {
+		usageError(name + ": " + err.Error())
+	}
+
+	files.Epoch = t
+	templates.Now = func() time.Time { return t }
+}
+
+// parseEpoch parses a time given as a number of seconds since the Unix epoch,
+// as in SOURCE_DATE_EPOCH.
+func parseEpoch(value string) (time.Time, error) {
+	secs, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected seconds "+
+			"since the Unix epoch", value)
+	}
+
+	return time.Unix(secs, 0).UTC(), nil
+}
+
+// parseTime parses a time given as a number of seconds since the Unix epoch,
+// see parseEpoch, an RFC 3339 date and time, e.g., "2024-01-02T15:04:05Z", or
+// a date, e.g., "2024-01-02", in UTC.
+func parseTime(value string) (time.Time, error) {
+	if t, err := parseEpoch(value); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, expected seconds "+
+		"since the Unix epoch, an RFC 3339 date and time or a date", value)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestParseTime(t *testing.T) {
+	epoch := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	date := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	zoned := time.Date(2024, 1, 2, 15, 4, 5, 0, time.FixedZone("", 3600))
+
+	cases := []struct {
+		value string
+		time  time.Time // zero for invalid values
+		epoch bool      // whether parseEpoch accepts the value too
+	}{
+		{"1700000000", epoch, true},
+		{"0", time.Unix(0, 0), true},
+		{"-86400", time.Unix(-86400, 0), true},
+		{"2024-01-02T15:04:05+01:00", zoned, false},
+		{"2024-01-02", date, false},
+		{"", time.Time{}, false},
+		{"1.5", time.Time{}, false},
+		{"2024-13-01", time.Time{}, false},
+		{"2024-01-02 15:04", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+
+	for _, c := range cases {
+		got, err := parseTime(c.value)
+		if c.time.IsZero() {
+			Want(t, err != nil)
+		} else {
+			Want(t, err == nil && got.Equal(c.time))
+		}
+
+		got, err = parseEpoch(c.value)
+		if c.epoch {
+			Want(t, err == nil && got.Equal(c.time))
+			Want(t, got.Location() == time.UTC)
+		} else {
+			Want(t, err != nil)
+		}
+	}
+}
@@ -1,21 +1,52 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
 )
 
+// diagnosticsFormat is the format in which errors and warnings are reported,
+// "text" for human-readable messages or "json" for one JSON object per line.
+var diagnosticsFormat = "text"
+
 func usageError(msg string) {
 	eprintln("%s: %s", progname, msg)
 	usage()
 	os.Exit(1)
 }
 
-func fail(msg string) {
-	eprintln("%s: %s", progname, msg)
+// failAt reports an error that happened at the given pipeline stage (0 for the
+// document, n for the n-th template, -1 for none) and exits. The message is
+// used as a prefix to the error message in text format.
+func failAt(stage int, msg string, err error) {
+	report(stage, msg, err)
 	os.Exit(2)
 }
 
+func report(stage int, msg string, err error) {
+	var d *diagnostics.Error
+	if !errors.As(err, &d) {
+		d = diagnostics.New("", "", err)
+	}
+
+	located := *d
+	located.Stage = stage
+
+	switch diagnosticsFormat {
+	case "json":
+		buf, _ := located.MarshalJSON()
+		eprintln("%s", buf)
+	default:
+		if located.Severity == diagnostics.SeverityWarning {
+			msg = "warning: " + msg
+		}
+		eprintln("%s: %s: %s", progname, msg, err)
+	}
+}
+
 func eprintln(format string, args ...any) {
 	fmt.Fprintf(os.Stderr, format, args...)
 	fmt.Fprintln(os.Stderr)
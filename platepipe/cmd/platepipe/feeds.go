@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	"cdop.pt/go/free/platepipe/collections"
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/feeds"
+	"cdop.pt/go/free/platepipe/templates"
+)
+
+// renderFeeds writes the feeds declared in the metadata of the template chain
+// or in the variables files, see the feeds package, of the collections
+// declared there, to the output directory.
+func renderFeeds(opts *options, c *chain) {
+	shared := c.shared()
+
+	fs, err := feeds.Parse(shared)
+	if err != nil {
+		failAt(-1, "invalid feeds",
+			diagnostics.New(diagnostics.KindMetadata, "", err))
+	}
+
+	if len(fs) == 0 {
+		return
+	}
+
+	if opts.base == "" {
+		usageError("no base URL specified for feeds")
+	}
+
+	cs, err := collections.Parse(shared)
+	if err != nil {
+		failAt(-1, "invalid collections",
+			diagnostics.New(diagnostics.KindMetadata, "", err))
+	}
+
+	for _, f := range fs {
+		var docs []any
+
+		for _, col := range cs {
+			if col.Name != f.Collection {
+				continue
+			}
+
+			col.Content = col.Content || f.Content
+
+			docs, err = c.loader(opts).Load(col)
+			if err != nil {
+				failAt(-1, "error loading feed", err)
+			}
+		}
+
+		if docs == nil {
+			failAt(-1, "invalid feeds", diagnostics.New(
+				diagnostics.KindMetadata, "",
+				fmt.Errorf("feed %q has unknown collection %q", f.Name,
+					f.Collection)))
+		}
+
+		w := createOutput(opts.output, f.URL)
+
+		err = f.Write(w, docs, opts.base, templates.Now())
+		if err != nil {
+			failAt(-1, "error writing feed",
+				diagnostics.New(diagnostics.KindIO, w.Name(), err))
+		}
+
+		closeOutput(w)
+	}
+}
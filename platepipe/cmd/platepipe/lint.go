@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+
+	"cdop.pt/go/free/platepipe/collections"
+	"cdop.pt/go/free/platepipe/feeds"
+	"cdop.pt/go/free/platepipe/search"
+	"cdop.pt/go/free/platepipe/templates"
+)
+
+// lintTemplateChain reports the problems found by templates.Lint and exits,
+// with status 2 if there were any. The variables read by the settings in
+// shared, the variables shared by all documents, and in the document, see
+// settingUses, are not reported as unused.
+func lintTemplateChain(
+	opts *options,
+	ts []*templates.Template,
+	program, shared map[string]any,
+	overridesFile string, overrides map[string]any,
+	documentFile string, document map[string]any,
+	defaultsFile string, defaults map[string]any,
+) {
+	problems := templates.Lint(ts,
+		templates.Layer{File: "", Stage: -1, Data: program,
+			Uses: settingUses(opts, shared, document)},
+		templates.Layer{File: overridesFile, Stage: -1, Data: overrides},
+		templates.Layer{File: documentFile, Stage: 0, Data: document,
+			Header: true},
+		templates.Layer{File: defaultsFile, Stage: -1, Data: defaults},
+	)
+
+	for _, p := range problems {
+		report(p.Stage, "lint", p)
+	}
+
+	if len(problems) > 0 {
+		os.Exit(2)
+	}
+
+	os.Exit(0)
+}
+
+// settingUses returns the metadata keys of documents read by the settings
+// declared in shared, the variables shared by all documents, or, for
+// collections, in the header of the document: the keys of taxonomies, see
+// collections.Taxonomy, the keys by which taxonomies and collections sort
+// documents, the fields of the search index, see search.Index, and the dates
+// and authors of feeds, see feeds.Feed.Write, and sitemaps, see
+// sitemaps.LastMod. Invalid settings are left out, they are reported when
+// rendering.
+func settingUses(opts *options, shared, header map[string]any) []string {
+	ret := []string{}
+
+	ts, _ := collections.ParseTaxonomies(shared)
+	for _, t := range ts {
+		ret = append(ret, t.Key, t.Sort)
+	}
+
+	for _, data := range []map[string]any{shared, header} {
+		cs, _ := collections.Parse(data)
+		for _, c := range cs {
+			ret = append(ret, c.Sort)
+		}
+	}
+
+	if x, _ := search.Parse(shared); x != nil {
+		ret = append(ret, x.Fields...)
+	}
+
+	if fs, _ := feeds.Parse(shared); len(fs) > 0 {
+		ret = append(ret, "date", "updated", "author")
+	}
+
+	if opts.sitemap {
+		ret = append(ret, "date", "updated")
+	}
+
+	return ret
+}
@@ -2,73 +2,62 @@ package main
 
 import (
 	"flag"
-	"io"
 	"os"
 	"path"
+	"slices"
 	"strings"
 
+	"cdop.pt/go/free/platepipe/collections"
+	"cdop.pt/go/free/platepipe/documents"
 	"cdop.pt/go/free/platepipe/documents/markdown"
-	"cdop.pt/go/free/platepipe/variables"
-	"github.com/yuin/goldmark"
-	"github.com/yuin/goldmark/extension"
+	"cdop.pt/go/free/platepipe/templates"
 )
 
 var progname = path.Base(os.Args[0])
 
 func init() {
 	flag.Usage = usage
-
-	opts := getEnabledGoldmarkExtensions()
-	gm := goldmark.New(opts...)
-	markdown.ToHTML = func(buf []byte, w io.Writer) error {
-		return gm.Convert(buf, w)
-	}
 }
 
-func getEnabledGoldmarkExtensions() []goldmark.Option {
-	value, defined := os.LookupEnv("PLATEPIPE_GOLDMARK_EXTS")
-	if !defined {
-		return []goldmark.Option{}
-	}
+func main() {
+	args := os.Args[1:]
 
-	valparts := strings.Split(value, ",")
-	exts := []goldmark.Extender{}
-
-	for _, v := range valparts {
-		switch strings.ToLower(v) {
-		case "table":
-			exts = append(exts, extension.Table)
-		case "strikethrough":
-			exts = append(exts, extension.Strikethrough)
-		case "linkify":
-			exts = append(exts, extension.Linkify)
-		case "tasklist":
-			exts = append(exts, extension.TaskList)
-		case "gfm":
-			exts = append(exts, extension.GFM)
-		case "definitionlist":
-			exts = append(exts, extension.DefinitionList)
-		case "footnote":
-			exts = append(exts, extension.Footnote)
-		case "typographer":
-			exts = append(exts, extension.Typographer)
-		case "cjk":
-			exts = append(exts, extension.CJK)
-		}
+	lint := len(args) > 0 && args[0] == "lint"
+	if lint {
+		args = args[1:]
 	}
 
-	return []goldmark.Option{goldmark.WithExtensions(exts...)}
-}
-
-func main() {
 	opts := &options{}
-	args := opts.Parse()
+	args = opts.Parse(args)
 	argc := len(args)
 
 	if opts.help {
 		help()
 	}
 
+	templates.Strict = opts.strict
+	templates.SearchPath = opts.includes
+	templates.DocumentTemplates = opts.docTemplate
+	documents.SummaryMarker = opts.summaryMarker
+	documents.SummaryWords = opts.summaryWords
+	documents.WordsPerMinute = opts.wordsPerMinute
+	documents.SlugRule = opts.slugRule
+	templates.ShortcodePath = opts.shortcodes
+	collections.Git = opts.git
+
+	configureClock(opts)
+
+	if !slices.Contains(markdown.SlugRules, opts.slugRule) {
+		usageError("unknown slug rule")
+	}
+
+	switch opts.diagnostics {
+	case "text", "json":
+		diagnosticsFormat = opts.diagnostics
+	default:
+		usageError("unknown diagnostics format")
+	}
+
 	if argc < 1 {
 		usageError("no document specified")
 	}
@@ -77,56 +66,148 @@ func main() {
 		usageError("no templates specified")
 	}
 
-	documentBuffer, documentMetadata, htmlSafe := loadDocumentAndMetadata(
-		args[0],
-		opts.docFmt,
-	)
+	docs := []string{args[0]}
 
-	templateChain, metadataChain := loadTemplateAndMetadataChains(
+	if isDirectory(args[0]) {
+		if lint {
+			usageError("cannot lint a document directory")
+		}
+		if opts.output == "" {
+			usageError("no output directory specified for document directory")
+		}
+
+		opts.root = args[0]
+		docs = findDocuments(args[0], opts.output)
+	}
+
+	if opts.sitemap && (opts.output == "" || opts.base == "") {
+		usageError("no output directory or base URL specified for sitemap")
+	}
+
+	if args[0] == "-" && opts.output != "" {
+		usageError("cannot write standard input document to output directory")
+	}
+
+	c := &chain{files: args[1:]}
+	c.templates, c.metadata = loadTemplateAndMetadataChains(
 		args[1:],
 		opts.tplFmt,
 	)
 
-	dataOverrides := loadVariables(opts.vOverrides)
-	dataDefaults := loadVariables(opts.vDefaults)
+	c.overrides = loadVariables(opts.vOverrides)
+	c.defaults = loadVariables(opts.vDefaults)
 
-	data := variables.Coalesce(
-		programMetadata(args),
-		dataOverrides,
-		documentMetadata,
-		variables.Coalesce(metadataChain...),
-		dataDefaults,
-	)
+	for i, p := range args[1:] {
+		c.info = append(c.info, fileMetadata(opts, p, i+1))
+	}
+
+	configureMarkdown(opts)
+
+	// lint exits when checking the document, before rendering anything
+	if opts.output != "" && !lint {
+		renderTaxonomies(opts, c, docs)
+		renderFeeds(opts, c)
+		loadSearchIndex(c)
+	}
+
+	for _, path := range docs {
+		renderFile(opts, c, path, lint)
+	}
 
-	runTemplatePipeline(string(documentBuffer), htmlSafe, templateChain, data)
+	if opts.sitemap {
+		writeSitemaps(opts)
+	}
+
+	if opts.output != "" {
+		writeSearchIndex(opts, c)
+	}
 }
 
 type options struct {
-	help       bool
-	vDefaults  string
-	vOverrides string
-	docFmt     string
-	tplFmt     string
+	help        bool
+	vDefaults   string
+	vOverrides  string
+	docFmt      string
+	tplFmt      string
+	strict      bool
+	docTemplate bool
+	includes    stringList
+	headingIDs  string
+	anchor      string
+	mdConfig    string
+	mdSettings  stringList
+
+	summaryMarker string
+	summaryWords  int
+
+	wordsPerMinute int
+	slugRule       string
+
+	root       string
+	git        bool
+	shortcodes stringList
+	time       string
+	output     string
+	base       string
+	sitemap    bool
+
+	diagnostics string
 }
 
-func (opts *options) Parse() []string {
+func (opts *options) Parse(args []string) []string {
 	flag.BoolVar(&opts.help, "h", false, "show this help")
 	flag.StringVar(&opts.vDefaults, "vd", "", "variable defaults, metadata variables from this file will be used if not defined anywhere in the rendering pipeline")
 	flag.StringVar(&opts.vOverrides, "vo", "", "variable overrides, metadata variables from this file will supersede variables from the rendering pipeline")
 	flag.StringVar(&opts.docFmt, "df", "", `document format, "txt" or "md", default: autodetect (txt for stdin)`)
 	flag.StringVar(&opts.tplFmt, "tf", "", `template format, "txt" or "html", default: autodetect (txt for stdin)`)
-
-	flag.Parse()
+	flag.StringVar(&opts.headingIDs, "ids", "", `generate heading IDs in Markdown documents with a slug rule, "github", "unicode" or "ascii", default: no IDs, documents may override this with "markdown.ids = ..." in their header`)
+	flag.StringVar(&opts.anchor, "anchor", "", `append permalink anchors with the given text, e.g. "¶", to Markdown headings with IDs, documents may override this with "markdown.anchor = ..." in their header`)
+	flag.StringVar(&opts.mdConfig, "mc", "", `Markdown configuration file, with settings such as "unsafe = true" (see -md)`)
+	flag.Var(&opts.mdSettings, "md", `set a Markdown setting, may be repeated, e.g. "unsafe=true", "hardwraps=true", "xhtml=true", "attributes=true", "extensions=gfm,footnote", "typographer.ldquo=«" or "footnote.prefix=doc-", documents may override these with "markdown.NAME = ..." in their header`)
+	flag.StringVar(&opts.summaryMarker, "sm", documents.SummaryMarker, `summary marker, the content of HTML and Markdown documents before it is available to templates as .summary.html and .summary.text, unless their header defines "summary"`)
+	flag.IntVar(&opts.summaryWords, "sw", documents.SummaryWords, "maximum number of words of the summaries of documents without a summary marker, cut on paragraph or sentence boundaries, 0 for the first paragraph")
+	flag.IntVar(&opts.wordsPerMinute, "wpm", documents.WordsPerMinute, "reading speed, in words per minute, used to estimate .document.readingTime")
+	flag.StringVar(&opts.slugRule, "slug", documents.SlugRule, `slug rule for .document.slug, generated from the title or the file name, "github", "unicode" or "ascii"`)
+	flag.StringVar(&opts.root, "root", ".", "input root directory, file paths in .file.relative and .templateFile.relative, and collection patterns, are relative to it, DOCUMENT itself if it is a directory")
+	flag.BoolVar(&opts.git, "git", false, "add the first and last commits of the document and template files, from the local git binary, to .file.git and .templateFile.git, and of collection documents, used as their last update in feeds and sitemaps")
+	flag.BoolVar(&opts.docTemplate, "dt", false, `render the document as a text template with the pipeline variables before converting it, documents may override this with "template = true|false" in their header`)
+	flag.BoolVar(&opts.strict, "strict", false, `fail on references to undefined variables instead of rendering "<no value>", templates may override this with "strict = true|false" in their header`)
+	flag.Var(&opts.includes, "I", "add a directory to the partial template search path, may be repeated")
+	flag.StringVar(&opts.output, "o", "", `output directory, render the document, or every Markdown, HTML and text document under DOCUMENT if it is a directory, to a file given by its URL, e.g. posts/hello.html for posts/hello.md or the "url" in its header, and the pages of documents which paginate a collection, with e.g. paginate = { collection = "posts", size = 10 } in their header, to page/2/index.html and so on`)
+	flag.StringVar(&opts.base, "base", "", `base URL of the site, e.g. "https://example.com", available to templates as .platepipe.baseURL and used to make the URLs of feeds absolute`)
+	flag.BoolVar(&opts.sitemap, "sitemap", false, `write sitemap.xml, listing the HTML pages written to the output directory, except for documents with sitemap = false in their header, with the last modification time from their "updated" header variable, their last commit with -git, their "date" header variable or their files, split into sitemaps listed by a sitemap index above 50000 pages, and robots.txt pointing to it, requires -o and -base`)
+	flag.StringVar(&opts.time, "time", "", `fixed time of the pipeline, .platepipe.time and the now function, in seconds since the Unix epoch, as an RFC 3339 date and time or as a date, for reproducible output, default: SOURCE_DATE_EPOCH if set, the current time otherwise (modification times later than a fixed time are clamped to it)`)
+	flag.Var(&opts.shortcodes, "sc", `add a directory to the shortcode template search path, may be repeated, shortcodes such as {{< figure src="x.png" >}} in documents render figure.html or figure.txt, outside code, shortcodes are only expanded if set`)
+	flag.StringVar(&opts.diagnostics, "diagnostics", "text", `format of error and warning messages, "text" or "json" (one object per line)`)
+
+	// flag.ExitOnError makes Parse exit instead of returning errors
+	_ = flag.CommandLine.Parse(args)
 
 	return flag.Args()
 }
 
+// stringList is a flag.Value for options that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func help() {
-	eprintln(`Usage: %s [OPTION]... [DOCUMENT] [TEMPLATE]...
+	eprintln(`Usage: %s [lint] [OPTION]... [DOCUMENT] [TEMPLATE]...
 
 When [DOCUMENT] is -, read document from standard input and assume`+
 		` plaintext format with TOML metadata header
 
+With lint, check the template chain for undefined variables, unused header`+
+		` variables, templates that ignore .content and calls to undefined`+
+		` templates, without rendering
+
 OPTIONS:`,
 		progname)
 
@@ -143,6 +224,48 @@ EXAMPLES:
   %[1]s doc.md template.html
     	render doc.md through template.html after converting Markdown to HTML
 
+  %[1]s doc.md page.html
+    	page.html may use .document.title, .document.headings, .document.links, .document.images and .document.languages, taken from doc.md, replacing any "document" variable defined in headers or variables files
+
+  %[1]s -ids github -anchor ¶ doc.md template.html
+    	render doc.md with GitHub-compatible heading IDs, e.g. <h2 id="getting-started">, and permalink anchors
+
+  %[1]s -md unsafe=true -md extensions=gfm,footnote doc.md template.html
+    	render doc.md with raw HTML and the GFM and footnote extensions
+
+  %[1]s -sw 30 doc.md teaser.html
+    	teaser.html may use .summary.html, .summary.text and .summary.truncated, the content of doc.md before <!--more--> or its first 30 words, cut on a paragraph or sentence boundary
+
+  %[1]s doc.txt template.html
+    	template.html may use .document.wordCount, .document.characterCount, .document.headingCount, .document.readingTime, .document.slug and .document.script
+
+  %[1]s -git -root content content/posts/doc.md template.html
+    	template.html may use .file and .templateFile, with the relative path, dir, name, ext, size and modified time of doc.md and template.html, and git.first.date, git.last.date, git.last.author and git.commits
+
+  SOURCE_DATE_EPOCH=1700000000 %[1]s doc.md template.html
+    	render doc.md with .platepipe.time and now fixed to 2023-11-14T22:13:20Z, so that the output is the same on every run
+
+  %[1]s index.md list.html
+    	with collections.posts = "posts/*.md" in the header of index.md or list.html, list.html may use {{ range sortBy "date" .collections.posts | reverse }} with the metadata, .url, .summary, .file and .document of each post
+
+  %[1]s -o public content page.html
+    	render every document under content through page.html to public, e.g. content/posts/hello.md to public/posts/hello.html and content/index.md to public/index.html
+
+  %[1]s -o public index.md list.html
+    	with paginate = { collection = "posts", size = 10 } in the header of list.html, render public/index.html, public/page/2/index.html and so on, where list.html may use .paginator.items, .paginator.page, .paginator.pages, .paginator.prev and .paginator.next
+
+  %[1]s -o public content page.html
+    	with taxonomies.tags = { term = "tag.html", index = "tags.html" } in the header of page.html, also render public/tags/index.html through tags.html and public/tags/go/index.html through tag.html for each tag, which may use .taxonomy.terms and .term.name, .term.count and .term.items, while all templates may use .taxonomies.tags
+
+  %[1]s -o public -base https://example.com content page.html
+    	with collections.posts = "posts/*.md" and feeds.blog = { collection = "posts", title = "Blog" } in the header of page.html, also write the Atom feed of the posts to public/blog.xml, or an RSS feed with format = "rss", from their title, date, updated, author and summary, or content with content = true
+
+  %[1]s -o public -base https://example.com -sitemap content page.html
+    	also write public/sitemap.xml, with the URLs of all HTML pages, and public/robots.txt
+
+  %[1]s -o public content page.html
+    	with search = { fields = ["tags", "date"], body = 300, index = true } in the header of page.html, also write public/search.json, with the URL, title, tags, date and plain text body, cut to 300 characters, of each document, except for those with search = false in their header, and an inverted index of the words of their titles and bodies
+
   %[1]s -df txt doc.md template.txt
     	do not convert doc.md to HTML before rendering
 
@@ -153,7 +276,25 @@ EXAMPLES:
     	treat template.html as a plaintext template
 
   %[1]s -tf txt doc.txt template.html
-    	treat template.html as a plaintext template`,
+    	treat template.html as a plaintext template
+
+  %[1]s -dt doc.md template.html
+    	render doc.md as a template first, so that it may contain e.g. "Version {{ .release }}"
+
+  %[1]s -sc shortcodes doc.md template.html
+    	render doc.md, expanding shortcodes such as {{< note >}}text{{< /note >}} with shortcodes/note.html
+
+  %[1]s -strict doc.md template.html
+    	fail instead of rendering "<no value>" for undefined variables
+
+  %[1]s -I partials doc.md template.html
+    	render doc.md through template.html, which may use {{ partial "nav.html" . }} to render partials/nav.html
+
+  %[1]s doc.md page.html
+    	with layout = "base.html" in the header of page.html, render base.html with the blocks defined in page.html
+
+  %[1]s lint doc.md template1.html template2.html
+    	check the chain without rendering, exit with status 2 on problems`,
 		progname,
 	)
 
@@ -161,6 +302,6 @@ EXAMPLES:
 }
 
 func usage() {
-	eprintln(`Usage: %s [OPTION]... [DOCUMENT] [TEMPLATE]...`, progname)
+	eprintln(`Usage: %s [lint] [OPTION]... [DOCUMENT] [TEMPLATE]...`, progname)
 	eprintln("Try '%s -h' for more information.", progname)
 }
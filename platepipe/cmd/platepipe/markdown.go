@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/documents/markdown"
+	"cdop.pt/go/free/platepipe/metadata/toml"
+)
+
+// configureMarkdown sets the default Markdown configuration of documents,
+// markdown.Defaults, with, in increasing order of priority, the extensions
+// listed in PLATEPIPE_GOLDMARK_EXTS, the Markdown configuration file and the
+// options, before any document is loaded. Documents may override it with the
+// settings in their header, see documentConverter.
+func configureMarkdown(opts *options) {
+	config := markdown.Config{}
+
+	if value, defined := os.LookupEnv("PLATEPIPE_GOLDMARK_EXTS"); defined {
+		err := config.Apply(map[string]any{"extensions": value})
+		if err == nil {
+			err = markdown.Configure(config)
+		}
+		if err != nil {
+			usageError("PLATEPIPE_GOLDMARK_EXTS: " + err.Error())
+		}
+	}
+
+	if opts.mdConfig != "" {
+		err := config.Apply(loadTomlFile(opts.mdConfig,
+			"error loading Markdown configuration"))
+		if err == nil {
+			err = markdown.Configure(config)
+		}
+		if err != nil {
+			failAt(-1, "invalid Markdown configuration",
+				diagnostics.New(diagnostics.KindMetadata, opts.mdConfig, err))
+		}
+	}
+
+	if opts.headingIDs != "" {
+		config.IDs = opts.headingIDs
+	}
+	if opts.anchor != "" {
+		config.Anchor = opts.anchor
+	}
+
+	for _, s := range opts.mdSettings {
+		settings, err := parseSetting(s)
+		if err == nil {
+			err = config.Apply(settings)
+		}
+		if err != nil {
+			usageError(err.Error())
+		}
+	}
+
+	err := markdown.Configure(config)
+	if err != nil {
+		usageError(err.Error())
+	}
+}
+
+// documentConverter returns the Markdown converter of the document, with the
+// default configuration overridden by the settings in its header, under the
+// "markdown" key, see markdown.ForDocument.
+func documentConverter(doc *document) *markdown.Converter {
+	conv, err := markdown.ForDocument(doc.data)
+	if err != nil {
+		failAt(0, "invalid Markdown settings",
+			diagnostics.New(diagnostics.KindMetadata, doc.file, err))
+	}
+
+	return conv
+}
+
+// parseSetting parses a NAME=VALUE setting, where VALUE is a TOML value or,
+// failing that, a string, e.g., "unsafe=true" or "ids=github", into settings
+// for markdown.Config.Apply. NAME may be a dotted key, e.g.,
+// "footnote.prefix=doc-".
+func parseSetting(s string) (map[string]any, error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("invalid Markdown setting %q, expected "+
+			"NAME=VALUE", s)
+	}
+
+	ret := map[string]any{}
+
+	err := toml.Parse([]byte(name+" = "+value), &ret)
+	if err != nil {
+		ret = map[string]any{}
+		err = toml.Parse([]byte(name+" = "+strconv.Quote(value)), &ret)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid Markdown setting %q: %w", s, err)
+	}
+
+	return ret, nil
+}
@@ -2,66 +2,311 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"os"
-	"time"
 
+	"cdop.pt/go/free/platepipe/collections"
+	"cdop.pt/go/free/platepipe/diagnostics"
 	"cdop.pt/go/free/platepipe/documents"
 	"cdop.pt/go/free/platepipe/documents/files"
+	"cdop.pt/go/free/platepipe/documents/markdown"
 	"cdop.pt/go/free/platepipe/metadata"
+	"cdop.pt/go/free/platepipe/search"
 	"cdop.pt/go/free/platepipe/templates"
+	"cdop.pt/go/free/platepipe/variables"
 )
 
-func loadDocumentAndMetadata(filePath, format string) (
-	[]byte, map[string]any, bool,
-) {
-	var buf []byte
-	var data map[string]any
-	var htmlSafe bool
-	var err error
+// document is a loaded document, whose content is not converted yet, so that
+// it can be rendered as a template first, see renderDocument.
+type document struct {
+	file     string // empty for standard input
+	body     []byte
+	data     map[string]any
+	line     int  // lines taken by the metadata header
+	markdown bool // body is to be converted from Markdown to HTML
+	htmlSafe bool
+	conv     *markdown.Converter // nil for the default configuration
+}
+
+// chain is the template chain, along with the metadata and information about
+// the files of its templates, the variables loaded from files, the loader of
+// the documents of the collections, taxonomies and feeds declared by them,
+// the collections, once loaded, the terms of taxonomies and the search index,
+// if any, which are shared by all documents, and the reserved variables they
+// define which were warned about, see warnReserved.
+type chain struct {
+	files       []string
+	templates   []*templates.Template
+	metadata    []map[string]any
+	info        []map[string]any
+	overrides   map[string]any
+	defaults    map[string]any
+	docs        *collections.Loader
+	collections map[string]any
+	taxonomies  map[string]any
+	index       *search.Index
+	warned      map[string]bool
+}
+
+// shared returns the variables shared by all documents, from the metadata of
+// the templates and the variables files, where site-wide settings such as
+// taxonomies and feeds are declared.
+func (c *chain) shared() map[string]any {
+	return variables.Coalesce(
+		c.overrides,
+		variables.Coalesce(c.metadata...),
+		c.defaults,
+	)
+}
+
+// loader returns the loader of the documents of the collections, taxonomies
+// and feeds declared in the shared variables, which loads each document once.
+func (c *chain) loader(opts *options) *collections.Loader {
+	if c.docs == nil {
+		c.docs = collections.NewLoader(opts.root, c.shared())
+	}
+
+	return c.docs
+}
+
+// renderFile renders the document at path through the template chain, to
+// standard output, or to the output directory, if set, where each page of
+// paginated documents is written, see paginate, and its first page is added
+// to the search index, if any. With lint, it checks the chain instead and
+// exits.
+func renderFile(opts *options, c *chain, path string, lint bool) {
+	doc := loadDocumentAndMetadata(path, opts.docFmt)
+
+	program := programMetadata(opts, path, c.files)
+	program["file"] = fileMetadata(opts, path, 0)
+
+	url := documentURL(doc, program["file"].(map[string]any))
+	if url != "" {
+		program["url"] = url
+	}
+
+	warnReserved(opts, c, doc, url)
+
+	if lint {
+		program["templateFile"] = map[string]any{}
+		program["document"] = documents.Measure(doc.file, nil, false, "")
+		if doc.markdown {
+			program["document"] = documents.Describe(doc.conv, doc.body, doc.data)
+		}
+		if _, ok := doc.data["summary"]; doc.htmlSafe && !ok {
+			program["summary"] = documents.Summarize(nil, nil)
+		}
+		if declares(doc, c, "paginate") {
+			program["paginator"] = map[string]any{}
+		}
+
+		lintTemplateChain(
+			opts,
+			c.templates,
+			program, c.shared(),
+			opts.vOverrides, c.overrides,
+			path, doc.data,
+			opts.vDefaults, c.defaults,
+		)
+	}
+
+	data := variables.Coalesce(
+		program,
+		c.overrides,
+		doc.data,
+		variables.Coalesce(c.metadata...),
+		c.defaults,
+	)
+
+	if c.taxonomies != nil {
+		data["taxonomies"] = c.taxonomies
+	}
+
+	loadCollections(opts, c, doc, data)
+
+	for _, page := range paginate(data, url) {
+		pageData := variables.Coalesce(data)
+		if page != nil {
+			pageData["paginator"] = page
+			pageData["url"] = page["url"]
+		}
+
+		content := renderDocument(doc, pageData)
+
+		if opts.output == "" {
+			runTemplatePipeline(content, doc.htmlSafe, c.templates, c.info,
+				pageData, os.Stdout)
+
+			// only the first page is rendered to standard output
+			return
+		}
+
+		w := createOutput(opts.output, pageData["url"].(string))
+		runTemplatePipeline(content, doc.htmlSafe, c.templates, c.info,
+			pageData, w)
+		closeOutput(w)
+
+		addToSitemap(opts, pageData["url"].(string), pageData)
+
+		if page == nil || page["page"] == 1 {
+			addToSearchIndex(c, doc, pageData["url"].(string), pageData,
+				content)
+		}
+	}
+}
+
+func loadDocumentAndMetadata(filePath, format string) *document {
+	doc := &document{file: filePath}
 
 	switch format {
 	case "md":
-		htmlSafe = true
-		if filePath == "-" {
-			buf, data, err = documents.FromMarkdownStream(os.Stdin)
-		} else {
-			buf, data, err = documents.FromMarkdownFile(filePath)
-		}
+		doc.markdown, doc.htmlSafe = true, true
 	case "html":
-		htmlSafe = true
-		if filePath == "-" {
-			buf, data, err = documents.FromTextStream(os.Stdin)
-		} else {
-			buf, data, err = documents.FromTextFile(filePath)
-		}
+		doc.htmlSafe = true
 	case "txt":
-		htmlSafe = false
-		if filePath == "-" {
-			buf, data, err = documents.FromTextStream(os.Stdin)
-		} else {
-			buf, data, err = documents.FromTextFile(filePath)
-		}
+		doc.htmlSafe = false
 	case "": // autodetect file type, assume plain text for stdin
-		if filePath == "-" {
-			htmlSafe = false
-			buf, data, err = documents.FromTextStream(os.Stdin)
-		} else {
-			htmlSafe = files.HasKnownHTMLExt(filePath) ||
-				files.HasKnownMarkdownExt(filePath)
-			buf, data, err = documents.FromFile(filePath)
+		if filePath != "-" {
+			doc.markdown = files.HasKnownMarkdownExt(filePath)
+			doc.htmlSafe = files.HasKnownHTMLExt(filePath) || doc.markdown
 		}
 	default:
 		usageError("unknown document format")
 	}
 
+	r := os.Stdin
+	if filePath == "-" {
+		doc.file = ""
+	} else {
+		f, err := os.Open(filePath)
+		if err != nil {
+			failAt(0, "error reading document",
+				diagnostics.New(diagnostics.KindIO, filePath, err))
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var err error
+	doc.body, doc.data, doc.line, err = documents.Read(doc.file, r)
 	if err != nil {
-		fail("error reading document: " + err.Error())
+		failAt(0, "error reading document", err)
 	}
 
-	return buf, data, htmlSafe
+	doc.conv = documentConverter(doc)
+
+	return doc
+}
+
+// warnReserved warns about the variables defined by the header of the
+// document, the template chain or variables files which the pipeline replaces
+// when rendering the document with the given URL, see renderFile,
+// renderDocument and runTemplatePipeline. Variables shared by all documents
+// are warned about once.
+func warnReserved(opts *options, c *chain, doc *document, url string) {
+	shared := c.shared()
+
+	_, hasSummary := doc.data["summary"]
+	_, paginated := variables.Coalesce(doc.data, shared)["paginate"]
+
+	// whether the pipeline replaces each variable in the header and in the
+	// shared variables, where the header sets the URL and summary of the
+	// document, and taxonomies are declared
+	reserved := []struct {
+		name           string
+		header, shared bool
+	}{
+		{"platepipe", true, true},
+		{"file", true, true},
+		{"url", false, url != ""},
+		{"document", true, true},
+		{"summary", false, doc.htmlSafe && !hasSummary},
+		{"paginator", paginated, paginated},
+		{"taxonomies", c.taxonomies != nil, false},
+		{"content", true, true},
+		{"templateFile", true, true},
+	}
+
+	warn := func(file string, stage int, key string) {
+		name := file
+		if name == "" {
+			name = "-"
+		}
+
+		e := diagnostics.New(diagnostics.KindMetadata, file, fmt.Errorf(
+			"%s: variable %q is reserved and replaced by the pipeline",
+			name, key))
+		e.Severity = diagnostics.SeverityWarning
+		report(stage, "reserved variable", e)
+	}
+
+	for _, k := range reserved {
+		if _, ok := doc.data[k.name]; ok && k.header {
+			warn(doc.file, 0, k.name)
+		}
+
+		file, stage, ok := c.defining(opts, k.name)
+		if !ok || !k.shared || c.warned[k.name] {
+			continue
+		}
+
+		if c.warned == nil {
+			c.warned = map[string]bool{}
+		}
+		c.warned[k.name] = true
+
+		warn(file, stage, k.name)
+	}
+}
+
+// defining returns the template or variables file which defines the shared
+// variable key, see chain.shared, with its pipeline stage, if any.
+func (c *chain) defining(opts *options, key string) (string, int, bool) {
+	if _, ok := c.overrides[key]; ok {
+		return opts.vOverrides, -1, true
+	}
+
+	for i, m := range c.metadata {
+		if _, ok := m[key]; ok {
+			return c.files[i], i + 1, true
+		}
+	}
+
+	if _, ok := c.defaults[key]; ok {
+		return opts.vDefaults, -1, true
+	}
+
+	return "", 0, false
+}
+
+// renderDocument renders the document with data, see templates.RenderContent,
+// returning the content passed to the template chain. The statistics of the
+// document, and the structure of Markdown documents, are added to data, under
+// the "document" key, and the summary of HTML and Markdown documents, under
+// the "summary" key, unless their header defines it.
+func renderDocument(doc *document, data map[string]any) string {
+	content, err := templates.RenderContent(&templates.Document{
+		File:     doc.file,
+		Body:     doc.body,
+		Header:   doc.data,
+		Line:     doc.line,
+		Markdown: doc.markdown,
+		HTMLSafe: doc.htmlSafe,
+		Conv:     doc.conv,
+	}, data)
+	if err != nil {
+		failAt(0, "error rendering document", err)
+	}
+
+	data["document"] = content.Document
+	if content.Summary != nil {
+		data["summary"] = content.Summary
+	}
+
+	return string(content.Body)
 }
 
 func loadTemplateAndMetadataChains(
@@ -85,10 +330,10 @@ func loadTemplateAndMetadataChains(
 	tchain := []*templates.Template{}
 	dchain := []map[string]any{}
 
-	for _, p := range filePaths {
+	for i, p := range filePaths {
 		t, data, err := loader(p)
 		if err != nil {
-			fail("error loading template: " + err.Error())
+			failAt(i+1, "error loading template", err)
 		}
 
 		tchain = append(tchain, t)
@@ -103,56 +348,163 @@ func loadVariables(filePath string) map[string]any {
 		return map[string]any{}
 	}
 
+	return loadTomlFile(filePath, "error loading variables")
+}
+
+// loadTomlFile loads a TOML file, such as a variables file, and exits with
+// the given message on errors.
+func loadTomlFile(filePath, msg string) map[string]any {
 	r, err := os.Open(filePath)
 	if err != nil {
-		fail("error loading variables: " + err.Error())
+		failAt(-1, msg, diagnostics.New(diagnostics.KindIO, filePath, err))
 	}
 	defer r.Close()
 
 	buf, err := io.ReadAll(r)
 	if err != nil {
-		fail("error loading variables: " + err.Error())
+		failAt(-1, msg, diagnostics.New(diagnostics.KindIO, filePath, err))
 	}
 
 	ret, err := metadata.FromTomlBuffer(buf)
 	if err != nil {
-		fail("error loading variables: " + err.Error())
+		var d *diagnostics.Error
+		if errors.As(err, &d) {
+			d.File = filePath
+		}
+		failAt(-1, msg, err)
 	}
 
 	return ret
 }
 
-func programMetadata(args []string) map[string]any {
+// loadCollections replaces the collections declared in data, the variables
+// of the document, under the "collections" key, with the documents they match
+// under the input root, see the collections package. Collections declared
+// only by the template chain or variables files are loaded once, with the
+// variables shared by all documents, see chain.shared, unless the header of
+// the document declares collections too.
+func loadCollections(
+	opts *options, c *chain, doc *document, data map[string]any,
+) {
+	if _, ok := data["collections"]; !ok {
+		return
+	}
+
+	if _, ok := doc.data["collections"]; ok {
+		data["collections"] = loadAllCollections(
+			collections.NewLoader(opts.root, data))
+		return
+	}
+
+	if c.collections == nil {
+		c.collections = loadAllCollections(c.loader(opts))
+	}
+
+	data["collections"] = c.collections
+}
+
+func loadAllCollections(l *collections.Loader) map[string]any {
+	cs, err := l.LoadAll()
+	if err != nil {
+		failAt(-1, "error loading collections", err)
+	}
+
+	return cs
+}
+
+func programMetadata(
+	opts *options, document string, tfiles []string,
+) map[string]any {
 	dir, _ := os.Getwd()
 
 	return map[string]any{
 		"platepipe": map[string]any{
-			"time":      time.Now(),
-			"document":  args[0],
-			"templates": args[1:],
+			"time":      templates.Now(),
+			"document":  document,
+			"templates": tfiles,
 			"directory": dir,
+			"baseURL":   opts.base,
 		},
 	}
 }
 
+// fileMetadata returns information about the file at path, loaded at the
+// given pipeline stage, relative to the input root, including its history if
+// git metadata is enabled, or an empty map for standard input.
+func fileMetadata(opts *options, path string, stage int) map[string]any {
+	if path == "-" {
+		return map[string]any{}
+	}
+
+	info, err := files.Info(path, opts.root)
+	if err != nil {
+		failAt(stage, "error reading file information",
+			diagnostics.New(diagnostics.KindIO, path, err))
+	}
+
+	if opts.git {
+		git, err := files.GitInfo(path)
+		if err != nil {
+			failAt(stage, "error reading git metadata",
+				diagnostics.New(diagnostics.KindIO, path, err))
+		}
+
+		if git != nil {
+			info["git"] = git
+		}
+	}
+
+	return info
+}
+
+// runTemplatePipeline renders the document content through the template
+// chain, with data, to w, where the information about the file of each
+// template, in tfiles, is available as .templateFile when rendering it.
 func runTemplatePipeline(
-	doc string, safe bool, ts []*templates.Template, data map[string]any,
+	doc string, safe bool, ts []*templates.Template, tfiles []map[string]any,
+	data map[string]any, w io.Writer,
 ) {
 	data["content"] = markSafeAsNeeded(doc, safe)
 
+	checkRequirements(ts, data)
+
 	buf := new(bytes.Buffer)
-	for _, t := range ts {
+	for i, t := range ts {
 		buf.Reset()
 
+		data["templateFile"] = tfiles[i]
+
 		err := t.Apply(buf, data)
 		if err != nil {
-			fail("error applying template: " + err.Error())
+			failAt(i+1, "error applying template", err)
 		}
 
 		data["content"] = markSafeAsNeeded(buf.String(), safe)
 	}
 
-	fmt.Fprint(os.Stdout, data["content"])
+	fmt.Fprint(w, data["content"])
+}
+
+// checkRequirements reports all the variables missing from data, or of the
+// wrong type, for all templates in the chain, and exits if there are any.
+func checkRequirements(ts []*templates.Template, data map[string]any) {
+	failed := false
+
+	for i, t := range ts {
+		err := templates.CheckRequirements(data, t)
+		if err == nil {
+			continue
+		}
+
+		for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+			report(i+1, "unmet template requirement", e)
+		}
+		failed = true
+	}
+
+	if failed {
+		os.Exit(2)
+	}
 }
 
 func markSafeAsNeeded(s string, safe bool) any {
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/search"
+)
+
+// loadSearchIndex sets up the search index declared in the metadata of the
+// template chain or in the variables files, if any, see the search package.
+func loadSearchIndex(c *chain) {
+	var err error
+
+	c.index, err = search.Parse(c.shared())
+	if err != nil {
+		failAt(-1, "invalid search index",
+			diagnostics.New(diagnostics.KindMetadata, "", err))
+	}
+}
+
+// addToSearchIndex adds the document with the given URL, variables and
+// content, as passed to the template chain, to the search index, if any,
+// unless excluded by its variables, see search.Included. Entries take their
+// title and fields from the header of the document, see search.Index.Add.
+func addToSearchIndex(
+	c *chain, doc *document, url string, data map[string]any, content string,
+) {
+	if c.index != nil && search.Included(data) {
+		info, _ := data["document"].(map[string]any)
+		c.index.Add(url, doc.data, info, []byte(content), doc.htmlSafe)
+	}
+}
+
+// writeSearchIndex writes the search index, if any, to the output directory.
+func writeSearchIndex(opts *options, c *chain) {
+	if c.index == nil {
+		return
+	}
+
+	w := createOutput(opts.output, c.index.URL)
+
+	err := c.index.Write(w)
+	if err != nil {
+		failAt(-1, "error writing search index",
+			diagnostics.New(diagnostics.KindIO, w.Name(), err))
+	}
+
+	closeOutput(w)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/feeds"
+	"cdop.pt/go/free/platepipe/sitemaps"
+)
+
+// sitemap holds the URLs of the HTML pages written to the output directory,
+// unless excluded by their variables, see sitemaps.Included.
+var sitemap []sitemaps.URL
+
+// addToSitemap adds the page with the given URL and variables to the sitemap,
+// if enabled, and if the page is an HTML page, i.e., its URL ends with a slash
+// or an HTML extension.
+func addToSitemap(opts *options, url string, data map[string]any) {
+	html := strings.HasSuffix(url, "/") || strings.HasSuffix(url, ".html") ||
+		strings.HasSuffix(url, ".htm")
+
+	if opts.sitemap && html && sitemaps.Included(data) {
+		sitemap = append(sitemap, sitemaps.URL{
+			Loc:     feeds.AbsURL(opts.base, url),
+			LastMod: sitemaps.LastMod(data),
+		})
+	}
+}
+
+// writeSitemaps writes the sitemap to sitemap.xml in the output directory,
+// or, if it holds more than sitemaps.MaxURLs URLs, to sitemap-1.xml,
+// sitemap-2.xml and so on, listed by a sitemap index in sitemap.xml, and a
+// robots.txt file pointing to sitemap.xml.
+func writeSitemaps(opts *options) {
+	chunks := sitemaps.Split(sitemap)
+
+	if len(chunks) == 1 {
+		writeSitemap(opts, "/sitemap.xml", func(w *os.File) error {
+			return sitemaps.Write(w, chunks[0])
+		})
+	} else {
+		index := []sitemaps.URL{}
+
+		for i, chunk := range chunks {
+			url := fmt.Sprintf("/sitemap-%d.xml", i+1)
+			writeSitemap(opts, url, func(w *os.File) error {
+				return sitemaps.Write(w, chunk)
+			})
+
+			index = append(index, sitemaps.URL{
+				Loc:     feeds.AbsURL(opts.base, url),
+				LastMod: sitemaps.Latest(chunk),
+			})
+		}
+
+		writeSitemap(opts, "/sitemap.xml", func(w *os.File) error {
+			return sitemaps.WriteIndex(w, index)
+		})
+	}
+
+	writeSitemap(opts, "/robots.txt", func(w *os.File) error {
+		return sitemaps.WriteRobots(w, feeds.AbsURL(opts.base, "/sitemap.xml"))
+	})
+}
+
+// writeSitemap creates the file with the given URL in the output directory,
+// and writes it with write.
+func writeSitemap(opts *options, url string, write func(*os.File) error) {
+	w := createOutput(opts.output, url)
+
+	err := write(w)
+	if err != nil {
+		failAt(-1, "error writing sitemap",
+			diagnostics.New(diagnostics.KindIO, w.Name(), err))
+	}
+
+	closeOutput(w)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"cdop.pt/go/free/platepipe/collections"
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/variables"
+)
+
+// renderTaxonomies classifies the documents at the given paths by the
+// taxonomies declared in the metadata of the template chain or in the
+// variables files, see collections.Taxonomy, so that their terms are
+// available to the templates of the chain, and renders the index and term
+// pages of each taxonomy to the output directory, through their own
+// templates, which may extend layouts.
+func renderTaxonomies(opts *options, c *chain, paths []string) {
+	shared := c.shared()
+
+	ts, err := collections.ParseTaxonomies(shared)
+	if err != nil {
+		failAt(-1, "invalid taxonomies",
+			diagnostics.New(diagnostics.KindMetadata, "", err))
+	}
+
+	if len(ts) == 0 {
+		return
+	}
+
+	docs, err := c.loader(opts).LoadFiles(collections.Collection{}, paths)
+	if err != nil {
+		failAt(-1, "error classifying documents", err)
+	}
+
+	c.taxonomies = collections.Classify(ts, docs)
+
+	for _, t := range ts {
+		terms := c.taxonomies[t.Name].([]any)
+		taxonomy := map[string]any{
+			"name":  t.Name,
+			"url":   t.URL(),
+			"terms": terms,
+		}
+
+		if t.Index != "" {
+			page := loadPageChain(opts, c, t.Index)
+			page.render(opts, t.URL(), map[string]any{"taxonomy": taxonomy})
+		}
+
+		if t.Term != "" {
+			page := loadPageChain(opts, c, t.Term)
+			for _, term := range terms {
+				term := term.(map[string]any)
+				page.render(opts, term["url"].(string), map[string]any{
+					"taxonomy": taxonomy,
+					"term":     term,
+				})
+			}
+		}
+	}
+}
+
+// loadPageChain returns a chain of a single template, for pages generated
+// without a document, sharing the variables and taxonomies of c.
+func loadPageChain(opts *options, c *chain, file string) *chain {
+	page := &chain{
+		files:      []string{file},
+		info:       []map[string]any{fileMetadata(opts, file, 1)},
+		overrides:  c.overrides,
+		defaults:   c.defaults,
+		taxonomies: c.taxonomies,
+	}
+	page.templates, page.metadata = loadTemplateAndMetadataChains(
+		page.files,
+		opts.tplFmt,
+	)
+
+	return page
+}
+
+// render renders a page generated without a document, with the given URL and
+// variables, through the chain, to the output directory.
+func (c *chain) render(opts *options, url string, vars map[string]any) {
+	program := programMetadata(opts, "", c.files)
+	program["url"] = url
+	program["taxonomies"] = c.taxonomies
+
+	data := variables.Coalesce(
+		program,
+		vars,
+		c.overrides,
+		variables.Coalesce(c.metadata...),
+		c.defaults,
+	)
+
+	w := createOutput(opts.output, url)
+	runTemplatePipeline("", true, c.templates, c.info, data, w)
+	closeOutput(w)
+
+	addToSitemap(opts, url, data)
+}
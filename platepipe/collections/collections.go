@@ -0,0 +1,425 @@
+// Package collections loads collections of documents, matched by glob
+// patterns, as data for templates, e.g., for index and listing pages.
+//
+// Collections are declared in metadata headers, under the "collections" key,
+// by name, with a pattern relative to the input root, or with a table holding
+// the pattern, whether to render the content of the documents and the
+// metadata key by which to sort them, and whether to reverse their order:
+//
+//	collections.posts = "posts/*.md"
+//	collections.notes = { pattern = "notes/**/*.md", content = true }
+//	collections.news = { pattern = "news/*.md", sort = "date", reverse = true }
+//
+// Patterns follow the syntax of path.Match, with forward slashes, and "**"
+// matching any number of directories.
+//
+// A collection is a list of documents, sorted by path unless declared
+// otherwise, which may also be sorted, filtered and grouped with the sortBy,
+// where and groupBy template functions, e.g.,
+// {{ range sortBy "date" .collections.posts | reverse }}.
+//
+// Collections may be split into pages, see Pagination, and documents may be
+// classified by the terms of taxonomies, such as tags, see Taxonomy.
+//
+// Errors returned by this package are *diagnostics.Error values.
+package collections
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	htemplate "html/template"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/documents"
+	"cdop.pt/go/free/platepipe/documents/files"
+	"cdop.pt/go/free/platepipe/documents/markdown"
+	"cdop.pt/go/free/platepipe/templates"
+	"cdop.pt/go/free/platepipe/variables"
+)
+
+// Git makes Load add the history of the files of documents from git, see
+// files.GitInfo, to the information about them, under the "git" key.
+var Git bool
+
+// Collection is a collection of documents, as declared in a metadata header.
+type Collection struct {
+	Name    string
+	Pattern string
+	Content bool   // whether to render the content of the documents
+	Sort    string // the metadata key to sort documents by, see Load
+	Reverse bool   // whether to reverse the order of the documents
+}
+
+// Parse reads the collections declared in metadata, under the "collections"
+// key, sorted by name.
+func Parse(data map[string]any) ([]Collection, error) {
+	if _, ok := data["collections"]; !ok {
+		return nil, nil
+	}
+
+	decls, ok := data["collections"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf(`"collections" must be a table`)
+	}
+
+	names := []string{}
+	for name := range decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := []Collection{}
+	for _, name := range names {
+		c := Collection{Name: name}
+
+		switch decl := decls[name].(type) {
+		case string:
+			c.Pattern = decl
+		case map[string]any:
+			c.Pattern, _ = decl["pattern"].(string)
+			if v, ok := decl["content"]; ok {
+				if c.Content, ok = v.(bool); !ok {
+					return nil, fmt.Errorf(
+						"collection %q must have a boolean content", name)
+				}
+			}
+			if v, ok := decl["sort"]; ok {
+				if c.Sort, ok = v.(string); !ok {
+					return nil, fmt.Errorf(
+						"collection %q must have a string sort", name)
+				}
+			}
+			if v, ok := decl["reverse"]; ok {
+				if c.Reverse, ok = v.(bool); !ok {
+					return nil, fmt.Errorf(
+						"collection %q must have a boolean reverse", name)
+				}
+			}
+		default:
+			return nil, fmt.Errorf(
+				"collection %q must be a pattern or a table", name)
+		}
+
+		if c.Pattern == "" {
+			return nil, fmt.Errorf("collection %q has no pattern", name)
+		}
+
+		if _, err := path.Match(c.Pattern, ""); err != nil {
+			return nil, fmt.Errorf(
+				"collection %q has bad pattern %q", name, c.Pattern)
+		}
+
+		ret = append(ret, c)
+	}
+
+	return ret, nil
+}
+
+// LoadAll loads the collections declared in data, see Parse, from files under
+// root, and returns them by name, as they are made available to templates
+// under the "collections" key. The documents are loaded with data, see Load.
+func LoadAll(data map[string]any, root string) (map[string]any, error) {
+	return NewLoader(root, data).LoadAll()
+}
+
+// Load loads the documents of the collection, matched under root, sorted by
+// path or, if set, by the values of the Sort key, as compared by
+// templates.Compare, keeping the order by path of documents with the same
+// value, and reversed if Reverse is set. Each document is a map holding its
+// metadata header and the following keys, unless the header defines them:
+//
+//	url      the URL of the document, see URL
+//	file     information about the file of the document, see files.Info,
+//	         and its history, if Git is set
+//	document the statistics of the document, and the structure of Markdown
+//	         documents, see documents.Measure and documents.Describe
+//	summary  the summary of HTML and Markdown documents, see
+//	         documents.Summarize
+//	content  the content of the document, converted from Markdown to HTML as
+//	         needed, if enabled for the collection
+//
+// Documents are rendered like the document of the pipeline, see
+// templates.RenderContent, with their metadata and data. Markdown documents
+// are converted with markdown.Defaults, overridden by the settings in their
+// header, see markdown.ForDocument.
+func (c Collection) Load(root string, data map[string]any) ([]any, error) {
+	return NewLoader(root, data).Load(c)
+}
+
+// LoadFiles loads the documents at the given paths, under root, like Load
+// loads the documents matched by the pattern of the collection, which is
+// ignored, e.g., to load all the documents of a batch build.
+func (c Collection) LoadFiles(
+	paths []string, root string, data map[string]any,
+) ([]any, error) {
+	return NewLoader(root, data).LoadFiles(c, paths)
+}
+
+// Loader loads the documents of collections under a root, with the same
+// data, see Collection.Load, loading each document once, e.g., for all the
+// collections, taxonomies and feeds of a batch build.
+type Loader struct {
+	root string
+	data map[string]any
+	docs map[string]*loaded // by path
+}
+
+// loaded is a document loaded by a Loader, along with its content, unless
+// its header defines it.
+type loaded struct {
+	doc     map[string]any
+	content any
+}
+
+// NewLoader returns a Loader of the documents under root, with data.
+func NewLoader(root string, data map[string]any) *Loader {
+	return &Loader{root: root, data: data, docs: map[string]*loaded{}}
+}
+
+// LoadAll loads the collections declared in the data of the loader, like the
+// LoadAll function.
+func (l *Loader) LoadAll() (map[string]any, error) {
+	cs, err := Parse(l.data)
+	if err != nil {
+		return nil, diagnostics.New(diagnostics.KindMetadata, "", err)
+	}
+
+	ret := map[string]any{}
+	for _, c := range cs {
+		docs, err := l.Load(c)
+		if err != nil {
+			return nil, err
+		}
+		ret[c.Name] = docs
+	}
+
+	return ret, nil
+}
+
+// Load loads the documents of a collection, see Collection.Load.
+func (l *Loader) Load(c Collection) ([]any, error) {
+	paths, err := glob(l.root, c.Pattern)
+	if err != nil {
+		return nil, diagnostics.New(diagnostics.KindIO, l.root, err)
+	}
+
+	return l.LoadFiles(c, paths)
+}
+
+// LoadFiles loads the documents at the given paths, see
+// Collection.LoadFiles.
+func (l *Loader) LoadFiles(c Collection, paths []string) ([]any, error) {
+	ret := []any{}
+	for _, p := range paths {
+		d, ok := l.docs[p]
+		if !ok {
+			var err error
+
+			d, err = l.load(p)
+			if err != nil {
+				return nil, err
+			}
+			l.docs[p] = d
+		}
+
+		doc := map[string]any{}
+		for k, v := range d.doc {
+			doc[k] = v
+		}
+		if c.Content && d.content != nil {
+			doc["content"] = d.content
+		}
+
+		ret = append(ret, doc)
+	}
+
+	sortDocuments(ret, c.Sort, c.Reverse)
+
+	return ret, nil
+}
+
+// sortDocuments sorts docs by the values of key, if not empty, as compared by
+// templates.Compare, keeping the order of documents with the same value, and
+// reverses their order if reverse is set.
+func sortDocuments(docs []any, key string, reverse bool) {
+	if key != "" {
+		sort.SliceStable(docs, func(i, j int) bool {
+			a := docs[i].(map[string]any)[key]
+			b := docs[j].(map[string]any)[key]
+			return templates.Compare(a, b) < 0
+		})
+	}
+
+	if reverse {
+		for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+			docs[i], docs[j] = docs[j], docs[i]
+		}
+	}
+}
+
+func (l *Loader) load(file string) (*loaded, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, diagnostics.New(diagnostics.KindIO, file, err)
+	}
+	defer f.Close()
+
+	body, header, line, err := documents.Read(file, f)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := files.Info(file, l.root)
+	if err != nil {
+		return nil, diagnostics.New(diagnostics.KindIO, file, err)
+	}
+
+	if Git {
+		git, err := files.GitInfo(file)
+		if err != nil {
+			return nil, diagnostics.New(diagnostics.KindIO, file, err)
+		}
+
+		if git != nil {
+			info["git"] = git
+		}
+	}
+
+	isMarkdown := files.HasKnownMarkdownExt(file)
+	htmlSafe := isMarkdown || files.HasKnownHTMLExt(file)
+
+	conv, err := markdown.ForDocument(header)
+	if err != nil {
+		return nil, diagnostics.New(diagnostics.KindMetadata, file, err)
+	}
+
+	content, err := templates.RenderContent(&templates.Document{
+		File:     file,
+		Body:     body,
+		Header:   header,
+		Line:     line,
+		Markdown: isMarkdown,
+		HTMLSafe: htmlSafe,
+		Conv:     conv,
+	}, variables.Coalesce(header, l.data))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &loaded{doc: map[string]any{
+		"url":      URL(info["relative"].(string)),
+		"file":     info,
+		"document": content.Document,
+	}}
+
+	if content.Summary != nil {
+		ret.doc["summary"] = content.Summary
+	}
+
+	if _, defined := header["content"]; !defined {
+		ret.content = string(content.Body)
+		if htmlSafe {
+			ret.content = htemplate.HTML(content.Body)
+		}
+	}
+
+	for k, v := range header {
+		ret.doc[k] = v
+	}
+
+	return ret, nil
+}
+
+// URL returns the URL of a document, relative to the root of the site, given
+// its path relative to the input root, with forward slashes. The extension
+// of the document is replaced with ".html", and index documents stand for
+// their directories, e.g., "/posts/hello.html" for "posts/hello.md" and
+// "/posts/" for "posts/index.md".
+func URL(relative string) string {
+	ret := "/" + strings.TrimSuffix(relative, path.Ext(relative))
+
+	if path.Base(ret) == "index" {
+		return strings.TrimSuffix(ret, "index")
+	}
+
+	return ret + ".html"
+}
+
+// glob returns the paths of the regular files under root matching pattern,
+// sorted.
+func glob(root, pattern string) ([]string, error) {
+	// walk only the directory given by the literal prefix of the pattern
+	segments := strings.Split(pattern, "/")
+	dir := ""
+	for len(segments) > 1 && !strings.ContainsAny(segments[0], `*?[\`) {
+		dir = path.Join(dir, segments[0])
+		segments = segments[1:]
+	}
+
+	start := filepath.Join(root, filepath.FromSlash(dir))
+	if _, err := os.Stat(start); os.IsNotExist(err) {
+		return []string{}, nil
+	}
+
+	ret := []string{}
+
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(start, p)
+		if err != nil {
+			return err
+		}
+
+		if match(segments, strings.Split(filepath.ToSlash(rel), "/")) {
+			ret = append(ret, p)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(ret)
+
+	return ret, nil
+}
+
+// match reports whether the segments of a path match the segments of a
+// pattern, where "**" matches any number of segments.
+func match(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if match(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	ok, _ := path.Match(pattern[0], segments[0])
+
+	return ok && match(pattern[1:], segments[1:])
+}
@@ -0,0 +1,316 @@
+package collections_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	htemplate "html/template"
+
+	"cdop.pt/go/free/platepipe/collections"
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/documents"
+	"cdop.pt/go/free/platepipe/documents/markdown"
+	. "cdop.pt/go/open/assertive"
+)
+
+func write(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		Need(t, os.MkdirAll(filepath.Dir(p), 0o700) == nil)
+		Need(t, os.WriteFile(p, []byte(content), 0o600) == nil)
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Run("declarations", func(t *testing.T) {
+		cs, err := collections.Parse(map[string]any{
+			"collections": map[string]any{
+				"posts": "posts/*.md",
+				"notes": map[string]any{"pattern": "notes/**", "content": true},
+			},
+		})
+
+		Need(t, err == nil)
+		Need(t, len(cs) == 2)
+		Want(t, cs[0] == collections.Collection{
+			Name: "notes", Pattern: "notes/**", Content: true,
+		})
+		Want(t, cs[1] == collections.Collection{
+			Name: "posts", Pattern: "posts/*.md",
+		})
+	})
+
+	t.Run("no declarations", func(t *testing.T) {
+		cs, err := collections.Parse(map[string]any{})
+
+		Want(t, err == nil)
+		Want(t, len(cs) == 0)
+	})
+
+	t.Run("bad declarations", func(t *testing.T) {
+		decls := []any{
+			"posts/*.md",
+			map[string]any{"posts": 1},
+			map[string]any{"posts": map[string]any{"content": true}},
+			map[string]any{"posts": map[string]any{
+				"pattern": "*.md", "content": "yes",
+			}},
+			map[string]any{"posts": map[string]any{
+				"pattern": "*.md", "sort": true,
+			}},
+			map[string]any{"posts": "posts/[.md"},
+		}
+
+		for _, d := range decls {
+			_, err := collections.Parse(map[string]any{"collections": d})
+			Want(t, err != nil)
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	write(t, root, map[string]string{
+		"posts/b.md": "title = \"B\"\ntags = [\"go\"]\n\n" +
+			"# Bee\n\nFirst.\n\n<!--more-->\n\nSecond.\n",
+		"posts/a.md":       "title = \"A\"\nsummary = \"Mine\"\n\nText.\n",
+		"posts/index.md":   "All posts.\n",
+		"posts/notes.txt":  "Not a post.\n",
+		"posts/2024/c.md":  "Nested.\n",
+		"pages/about.html": "url = \"/about/\"\n\n<p>About.</p>\n",
+	})
+
+	t.Run("pattern", func(t *testing.T) {
+		c := collections.Collection{Name: "posts", Pattern: "posts/*.md"}
+
+		docs, err := c.Load(root, map[string]any{})
+
+		Need(t, err == nil)
+		Need(t, len(docs) == 3)
+
+		a := docs[0].(map[string]any)
+		Want(t, a["title"] == "A")
+		Want(t, a["url"] == "/posts/a.html")
+		Want(t, a["summary"] == "Mine")
+		Want(t, a["file"].(map[string]any)["relative"] == "posts/a.md")
+		Want(t, a["document"].(map[string]any)["wordCount"] == 1)
+		_, ok := a["content"]
+		Want(t, !ok)
+
+		b := docs[1].(map[string]any)
+		Want(t, b["url"] == "/posts/b.html")
+		Want(t, b["document"].(map[string]any)["title"] == "B")
+		Want(t, b["tags"].([]any)[0] == "go")
+
+		summary := b["summary"].(map[string]any)
+		Want(t, summary["text"] == "Bee\nFirst.")
+		Want(t, summary["truncated"] == true)
+
+		index := docs[2].(map[string]any)
+		Want(t, index["url"] == "/posts/")
+	})
+
+	t.Run("recursive pattern", func(t *testing.T) {
+		c := collections.Collection{Name: "all", Pattern: "**/*.md"}
+
+		docs, err := c.Load(root, map[string]any{})
+
+		Need(t, err == nil)
+		Need(t, len(docs) == 4)
+		Want(t, docs[0].(map[string]any)["url"] == "/posts/2024/c.html")
+	})
+
+	t.Run("content", func(t *testing.T) {
+		c := collections.Collection{
+			Name: "pages", Pattern: "pages/*", Content: true,
+		}
+
+		docs, err := c.Load(root, map[string]any{})
+
+		Need(t, err == nil)
+		Need(t, len(docs) == 1)
+
+		about := docs[0].(map[string]any)
+		Want(t, about["url"] == "/about/")
+		Want(t, about["content"] == htemplate.HTML("<p>About.</p>\n"))
+	})
+
+	t.Run("sort", func(t *testing.T) {
+		c := collections.Collection{
+			Name: "posts", Pattern: "posts/*.md", Sort: "title", Reverse: true,
+		}
+
+		docs, err := c.Load(root, map[string]any{})
+
+		Need(t, err == nil)
+		Need(t, len(docs) == 3)
+		Want(t, docs[0].(map[string]any)["title"] == "B")
+		Want(t, docs[1].(map[string]any)["title"] == "A")
+		Want(t, docs[2].(map[string]any)["url"] == "/posts/")
+	})
+
+	t.Run("markdown settings", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, map[string]string{
+			"a.md": "markdown.hardwraps = true\n\nA\nB\n",
+			"b.md": "C\nD\n",
+			"c.md": "markdown = 1\n\nE\n",
+		})
+
+		Need(t, markdown.Configure(markdown.Config{IDs: "github"}) == nil)
+		defer func() { _ = markdown.Configure(markdown.Config{}) }()
+
+		c := collections.Collection{Name: "md", Pattern: "*.md", Content: true}
+
+		_, err := c.Load(dir, map[string]any{})
+
+		var d *diagnostics.Error
+		Need(t, errors.As(err, &d))
+		Want(t, d.File == filepath.Join(dir, "c.md"))
+
+		Need(t, os.Remove(filepath.Join(dir, "c.md")) == nil)
+
+		docs, err := c.Load(dir, map[string]any{})
+
+		Need(t, err == nil)
+		Need(t, len(docs) == 2)
+		Want(t, docs[0].(map[string]any)["content"] ==
+			htemplate.HTML("<p>A<br>\nB</p>\n"))
+		Want(t, docs[1].(map[string]any)["content"] ==
+			htemplate.HTML("<p>C\nD</p>\n"))
+
+		html, err := documents.MarkdownToHTML(nil, "", []byte("# H\nA\nB"))
+
+		Need(t, err == nil)
+		Want(t, string(html) == `<h1 id="h">H</h1>`+"\n<p>A\nB</p>\n")
+	})
+
+	t.Run("loader", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, map[string]string{"a.md": "A\n", "b.md": "B\n"})
+
+		l := collections.NewLoader(dir, map[string]any{})
+
+		docs, err := l.Load(collections.Collection{Name: "a", Pattern: "a.md"})
+
+		Need(t, err == nil && len(docs) == 1)
+		_, ok := docs[0].(map[string]any)["content"]
+		Want(t, !ok)
+
+		write(t, dir, map[string]string{"a.md": "Changed\n"})
+
+		docs, err = l.Load(collections.Collection{
+			Name: "all", Pattern: "*.md", Content: true,
+		})
+
+		Need(t, err == nil && len(docs) == 2)
+		Want(t, docs[0].(map[string]any)["content"] ==
+			htemplate.HTML("<p>A</p>\n"))
+		Want(t, docs[1].(map[string]any)["content"] ==
+			htemplate.HTML("<p>B</p>\n"))
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		c := collections.Collection{Name: "none", Pattern: "drafts/*.md"}
+
+		docs, err := c.Load(root, map[string]any{})
+
+		Want(t, err == nil)
+		Want(t, len(docs) == 0)
+	})
+}
+
+func TestLoadGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	defer func(git bool) { collections.Git = git }(collections.Git)
+
+	root := t.TempDir()
+	write(t, root, map[string]string{"posts/a.md": "A.\n"})
+
+	date := "2024-01-02T03:04:05Z"
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "posts/a.md"},
+		{"commit", "-q", "-m", "first"},
+	} {
+		cmd := exec.Command("git", append([]string{
+			"-c", "user.name=A", "-c", "user.email=a@example.com",
+			"-c", "commit.gpgsign=false",
+		}, args...)...)
+		cmd.Dir = root
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Log(string(out))
+		}
+		Need(t, err == nil)
+	}
+
+	c := collections.Collection{Name: "posts", Pattern: "posts/*.md"}
+
+	collections.Git = false
+	docs, err := c.Load(root, map[string]any{})
+
+	Need(t, err == nil && len(docs) == 1)
+	_, ok := docs[0].(map[string]any)["file"].(map[string]any)["git"]
+	Want(t, !ok)
+
+	collections.Git = true
+	docs, err = c.Load(root, map[string]any{})
+
+	Need(t, err == nil && len(docs) == 1)
+	git := docs[0].(map[string]any)["file"].(map[string]any)["git"]
+	last := git.(map[string]any)["last"].(map[string]any)
+	Want(t, last["date"].(time.Time).Equal(
+		time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+}
+
+func TestLoadAll(t *testing.T) {
+	root := t.TempDir()
+	write(t, root, map[string]string{
+		"posts/a.md": "template = true\n\nBy {{ .author }}.\n",
+	})
+
+	cs, err := collections.LoadAll(map[string]any{
+		"author":      "Ann",
+		"collections": map[string]any{"posts": "posts/*.md"},
+	}, root)
+
+	Need(t, err == nil)
+
+	posts := cs["posts"].([]any)
+	Need(t, len(posts) == 1)
+	Want(t, posts[0].(map[string]any)["summary"].(map[string]any)["text"] ==
+		"By Ann.")
+
+	_, err = collections.LoadAll(map[string]any{"collections": "*.md"}, root)
+
+	var d *diagnostics.Error
+	Need(t, errors.As(err, &d))
+	Want(t, d.Kind == diagnostics.KindMetadata)
+	Want(t, strings.Contains(err.Error(), "must be a table"))
+}
+
+func TestURL(t *testing.T) {
+	urls := map[string]string{
+		"hello.md":         "/hello.html",
+		"posts/hello.md":   "/posts/hello.html",
+		"posts/index.md":   "/posts/",
+		"index.html":       "/",
+		"notes/reindex.md": "/notes/reindex.html",
+	}
+
+	for rel, url := range urls {
+		Want(t, collections.URL(rel) == url)
+	}
+}
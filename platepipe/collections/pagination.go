@@ -0,0 +1,142 @@
+package collections
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PageSize is the number of documents per page of paginations that do not
+// declare it, see Pagination.
+var PageSize = 10
+
+// Pagination is the pagination of a collection, as declared in a metadata
+// header, usually of the template of a listing page, under the "paginate"
+// key, with the name of the collection, or with a table holding the name and
+// the number of documents per page:
+//
+//	paginate = "posts"
+//	paginate = { collection = "posts", size = 5 }
+type Pagination struct {
+	Collection string
+	Size       int
+}
+
+// ParsePagination reads the pagination declared in metadata, under the
+// "paginate" key, or returns nil if there is none.
+func ParsePagination(data map[string]any) (*Pagination, error) {
+	if _, ok := data["paginate"]; !ok {
+		return nil, nil
+	}
+
+	p := &Pagination{Size: PageSize}
+
+	switch decl := data["paginate"].(type) {
+	case string:
+		p.Collection = decl
+	case map[string]any:
+		p.Collection, _ = decl["collection"].(string)
+		if v, ok := decl["size"]; ok {
+			size := reflect.ValueOf(v)
+			if !size.CanInt() || size.Int() < 1 {
+				return nil, fmt.Errorf(
+					`"paginate" must have a positive integer size`)
+			}
+			p.Size = int(size.Int())
+		}
+	default:
+		return nil, fmt.Errorf(`"paginate" must be a collection or a table`)
+	}
+
+	if p.Collection == "" {
+		return nil, fmt.Errorf(`"paginate" has no collection`)
+	}
+
+	return p, nil
+}
+
+// Pages splits the documents of the paginated collection, in collections,
+// as returned by LoadAll, into pages of the listing page with the given URL,
+// see PageURL, and returns their paginators, made available to templates
+// under the "paginator" key. The URL must end with "/" or ".html", since the
+// other pages are written under it. Paginators are maps with the following
+// keys:
+//
+//	items the documents of the page
+//	page  the number of the page, starting at 1
+//	pages the number of pages, at least 1, even without documents
+//	size  the maximum number of documents per page
+//	total the number of documents in the collection
+//	url   the URL of the page
+//	first the URL of the first page
+//	last  the URL of the last page
+//	prev  the URL of the previous page, empty on the first page
+//	next  the URL of the next page, empty on the last page
+func (p *Pagination) Pages(
+	collections map[string]any, url string,
+) ([]map[string]any, error) {
+	items, ok := collections[p.Collection].([]any)
+	if !ok {
+		return nil, fmt.Errorf("cannot paginate unknown collection %q",
+			p.Collection)
+	}
+
+	if !strings.HasSuffix(url, "/") && !strings.HasSuffix(url, ".html") {
+		return nil, fmt.Errorf("cannot paginate %q, the URL of paginated "+
+			`documents must end with "/" or ".html"`, url)
+	}
+
+	pages := (len(items) + p.Size - 1) / p.Size
+	if pages == 0 {
+		pages = 1
+	}
+
+	ret := []map[string]any{}
+	for i := 1; i <= pages; i++ {
+		start, end := (i-1)*p.Size, i*p.Size
+		if end > len(items) {
+			end = len(items)
+		}
+
+		prev, next := "", ""
+		if i > 1 {
+			prev = PageURL(url, i-1)
+		}
+		if i < pages {
+			next = PageURL(url, i+1)
+		}
+
+		ret = append(ret, map[string]any{
+			"items": items[start:end],
+			"page":  i,
+			"pages": pages,
+			"size":  p.Size,
+			"total": len(items),
+			"url":   PageURL(url, i),
+			"first": PageURL(url, 1),
+			"last":  PageURL(url, pages),
+			"prev":  prev,
+			"next":  next,
+		})
+	}
+
+	return ret, nil
+}
+
+// PageURL returns the URL of the given page of the listing page with the
+// given URL, which is the URL itself for the first page, and a page directory
+// under the URL, without its ".html" extension, for other pages, e.g.,
+// "/posts/page/2/" for "/posts/" and "/blog/page/2/" for "/blog.html".
+func PageURL(url string, page int) string {
+	if page <= 1 {
+		return url
+	}
+
+	base := strings.TrimSuffix(url, ".html")
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+
+	return base + "page/" + strconv.Itoa(page) + "/"
+}
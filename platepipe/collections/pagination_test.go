@@ -0,0 +1,110 @@
+package collections_test
+
+import (
+	"testing"
+
+	"cdop.pt/go/free/platepipe/collections"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestParsePagination(t *testing.T) {
+	p, err := collections.ParsePagination(map[string]any{"paginate": "posts"})
+
+	Need(t, err == nil)
+	Want(t, *p == collections.Pagination{
+		Collection: "posts", Size: collections.PageSize,
+	})
+
+	p, err = collections.ParsePagination(map[string]any{
+		"paginate": map[string]any{"collection": "posts", "size": int64(5)},
+	})
+
+	Need(t, err == nil)
+	Want(t, *p == collections.Pagination{Collection: "posts", Size: 5})
+
+	p, err = collections.ParsePagination(map[string]any{})
+
+	Want(t, err == nil)
+	Want(t, p == nil)
+
+	decls := []any{
+		1,
+		map[string]any{"size": int64(5)},
+		map[string]any{"collection": "posts", "size": int64(0)},
+		map[string]any{"collection": "posts", "size": "5"},
+	}
+
+	for _, d := range decls {
+		_, err := collections.ParsePagination(map[string]any{"paginate": d})
+		Want(t, err != nil)
+	}
+}
+
+func TestPages(t *testing.T) {
+	items := []any{}
+	for i := 0; i < 5; i++ {
+		items = append(items, i)
+	}
+	cs := map[string]any{"posts": items, "none": []any{}}
+
+	t.Run("pages", func(t *testing.T) {
+		p := &collections.Pagination{Collection: "posts", Size: 2}
+
+		pages, err := p.Pages(cs, "/posts/")
+
+		Need(t, err == nil)
+		Need(t, len(pages) == 3)
+
+		first, last := pages[0], pages[2]
+		Want(t, len(first["items"].([]any)) == 2)
+		Want(t, first["page"] == 1)
+		Want(t, first["pages"] == 3)
+		Want(t, first["total"] == 5)
+		Want(t, first["url"] == "/posts/")
+		Want(t, first["prev"] == "")
+		Want(t, first["next"] == "/posts/page/2/")
+		Want(t, first["last"] == "/posts/page/3/")
+
+		Want(t, last["items"].([]any)[0] == 4)
+		Want(t, last["url"] == "/posts/page/3/")
+		Want(t, last["prev"] == "/posts/page/2/")
+		Want(t, last["next"] == "")
+		Want(t, last["first"] == "/posts/")
+	})
+
+	t.Run("no items", func(t *testing.T) {
+		p := &collections.Pagination{Collection: "none", Size: 2}
+
+		pages, err := p.Pages(cs, "/")
+
+		Need(t, err == nil)
+		Need(t, len(pages) == 1)
+		Want(t, len(pages[0]["items"].([]any)) == 0)
+		Want(t, pages[0]["pages"] == 1)
+	})
+
+	t.Run("unknown collection", func(t *testing.T) {
+		p := &collections.Pagination{Collection: "drafts", Size: 2}
+
+		_, err := p.Pages(cs, "/")
+
+		Want(t, err != nil)
+	})
+
+	t.Run("url", func(t *testing.T) {
+		p := &collections.Pagination{Collection: "posts", Size: 2}
+
+		_, err := p.Pages(cs, "/blog.html")
+		Want(t, err == nil)
+
+		_, err = p.Pages(cs, "/about")
+		Want(t, err != nil)
+	})
+}
+
+func TestPageURL(t *testing.T) {
+	Want(t, collections.PageURL("/", 1) == "/")
+	Want(t, collections.PageURL("/", 2) == "/page/2/")
+	Want(t, collections.PageURL("/posts/", 3) == "/posts/page/3/")
+	Want(t, collections.PageURL("/blog.html", 2) == "/blog/page/2/")
+}
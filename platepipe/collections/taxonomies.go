@@ -0,0 +1,179 @@
+package collections
+
+import (
+	"fmt"
+	"sort"
+
+	"cdop.pt/go/free/platepipe/documents"
+	"cdop.pt/go/free/platepipe/documents/markdown"
+)
+
+// Taxonomy is a classification of documents by the terms held by a metadata
+// key, e.g., tags = ["go", "templates"], as declared in a metadata header,
+// under the "taxonomies" key, by name, with a table holding the templates of
+// the pages listing the documents of each term and of the index page listing
+// the terms, if any, the metadata key, if not the name, and the metadata key
+// by which to sort the documents of each term, and whether to reverse their
+// order, as for collections:
+//
+//	taxonomies.tags = { term = "tag.html", index = "tags.html" }
+//	taxonomies.categories = { key = "category", sort = "date", reverse = true }
+type Taxonomy struct {
+	Name    string
+	Key     string // the metadata key holding the terms, Name by default
+	Term    string // the template of the pages of terms, empty for none
+	Index   string // the template of the index page, empty for none
+	Sort    string // the metadata key to sort documents by
+	Reverse bool   // whether to reverse the order of the documents
+}
+
+// ParseTaxonomies reads the taxonomies declared in metadata, under the
+// "taxonomies" key, sorted by name.
+func ParseTaxonomies(data map[string]any) ([]Taxonomy, error) {
+	if _, ok := data["taxonomies"]; !ok {
+		return nil, nil
+	}
+
+	decls, ok := data["taxonomies"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf(`"taxonomies" must be a table`)
+	}
+
+	names := []string{}
+	for name := range decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := []Taxonomy{}
+	for _, name := range names {
+		decl, ok := decls[name].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("taxonomy %q must be a table", name)
+		}
+
+		t := Taxonomy{Name: name, Key: name}
+
+		fields := []struct {
+			key   string
+			value *string
+		}{
+			{"key", &t.Key}, {"term", &t.Term}, {"index", &t.Index},
+			{"sort", &t.Sort},
+		}
+
+		for _, f := range fields {
+			if v, ok := decl[f.key]; ok {
+				if *f.value, ok = v.(string); !ok {
+					return nil, fmt.Errorf(
+						"taxonomy %q must have a string %s", name, f.key)
+				}
+			}
+		}
+
+		if v, ok := decl["reverse"]; ok {
+			if t.Reverse, ok = v.(bool); !ok {
+				return nil, fmt.Errorf(
+					"taxonomy %q must have a boolean reverse", name)
+			}
+		}
+
+		if markdown.Slug(name, documents.SlugRule) == "" {
+			return nil, fmt.Errorf("taxonomy %q has no slug", name)
+		}
+
+		ret = append(ret, t)
+	}
+
+	return ret, nil
+}
+
+// URL returns the URL of the index page of the taxonomy, e.g., "/tags/".
+// The pages of its terms are under it, see Terms.
+func (t Taxonomy) URL() string {
+	return "/" + markdown.Slug(t.Name, documents.SlugRule) + "/"
+}
+
+// Terms returns the terms of the taxonomy held by docs, as loaded by Load,
+// sorted by slug, as maps with the following keys:
+//
+//	name  the term, as first found in docs
+//	slug  the slug of the term, see markdown.Slug and documents.SlugRule
+//	url   the URL of the page of the term, e.g., "/tags/go/"
+//	count the number of documents with the term
+//	items the documents with the term, sorted as declared for the taxonomy
+//
+// Terms are strings, or lists of strings, and terms with the same slug, e.g.,
+// "Go" and "go", are the same term. Terms without a slug are left out.
+func (t Taxonomy) Terms(docs []any) []any {
+	terms := map[string]map[string]any{}
+
+	for _, doc := range docs {
+		var names []any
+
+		switch v := doc.(map[string]any)[t.Key].(type) {
+		case string:
+			names = []any{v}
+		case []any:
+			names = v
+		}
+
+		seen := map[string]bool{}
+
+		for _, name := range names {
+			name, ok := name.(string)
+			if !ok {
+				continue
+			}
+
+			slug := markdown.Slug(name, documents.SlugRule)
+			if slug == "" || seen[slug] {
+				continue
+			}
+			seen[slug] = true
+
+			term, ok := terms[slug]
+			if !ok {
+				term = map[string]any{
+					"name":  name,
+					"slug":  slug,
+					"url":   t.URL() + slug + "/",
+					"items": []any{},
+				}
+				terms[slug] = term
+			}
+			term["items"] = append(term["items"].([]any), doc)
+		}
+	}
+
+	slugs := []string{}
+	for slug := range terms {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+
+	ret := []any{}
+	for _, slug := range slugs {
+		term := terms[slug]
+		items := term["items"].([]any)
+
+		sortDocuments(items, t.Sort, t.Reverse)
+		term["count"] = len(items)
+
+		ret = append(ret, term)
+	}
+
+	return ret
+}
+
+// Classify returns the terms of each of the given taxonomies held by docs,
+// see Terms, by name, as they are made available to templates under the
+// "taxonomies" key.
+func Classify(ts []Taxonomy, docs []any) map[string]any {
+	ret := map[string]any{}
+	for _, t := range ts {
+		ret[t.Name] = t.Terms(docs)
+	}
+
+	return ret
+}
@@ -0,0 +1,77 @@
+package collections_test
+
+import (
+	"testing"
+
+	"cdop.pt/go/free/platepipe/collections"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestParseTaxonomies(t *testing.T) {
+	ts, err := collections.ParseTaxonomies(map[string]any{
+		"taxonomies": map[string]any{
+			"tags": map[string]any{"term": "tag.html", "index": "tags.html"},
+			"categories": map[string]any{
+				"key": "category", "sort": "date", "reverse": true,
+			},
+		},
+	})
+
+	Need(t, err == nil)
+	Need(t, len(ts) == 2)
+	Want(t, ts[0] == collections.Taxonomy{
+		Name: "categories", Key: "category", Sort: "date", Reverse: true,
+	})
+	Want(t, ts[1] == collections.Taxonomy{
+		Name: "tags", Key: "tags", Term: "tag.html", Index: "tags.html",
+	})
+	Want(t, ts[1].URL() == "/tags/")
+
+	ts, err = collections.ParseTaxonomies(map[string]any{})
+
+	Want(t, err == nil)
+	Want(t, len(ts) == 0)
+
+	decls := []any{
+		"tags",
+		map[string]any{"tags": "tag.html"},
+		map[string]any{"tags": map[string]any{"term": 1}},
+		map[string]any{"tags": map[string]any{"reverse": "yes"}},
+		map[string]any{"!!": map[string]any{}},
+	}
+
+	for _, d := range decls {
+		_, err := collections.ParseTaxonomies(map[string]any{"taxonomies": d})
+		Want(t, err != nil)
+	}
+}
+
+func TestTerms(t *testing.T) {
+	a := map[string]any{"title": "A", "date": 2, "tags": []any{"Go", "web"}}
+	b := map[string]any{"title": "B", "date": 3, "tags": []any{"go", "go"}}
+	c := map[string]any{"title": "C", "date": 1, "tags": "web"}
+	d := map[string]any{"title": "D", "tags": []any{1, "!!"}}
+
+	tags := collections.Taxonomy{
+		Name: "tags", Key: "tags", Sort: "date", Reverse: true,
+	}
+
+	terms := tags.Terms([]any{a, b, c, d})
+
+	Need(t, len(terms) == 2)
+
+	golang := terms[0].(map[string]any)
+	Want(t, golang["name"] == "Go")
+	Want(t, golang["slug"] == "go")
+	Want(t, golang["url"] == "/tags/go/")
+	Want(t, golang["count"] == 2)
+	Want(t, golang["items"].([]any)[0].(map[string]any)["title"] == "B")
+
+	web := terms[1].(map[string]any)
+	Want(t, web["count"] == 2)
+	Want(t, web["items"].([]any)[0].(map[string]any)["title"] == "A")
+
+	all := collections.Classify([]collections.Taxonomy{tags}, []any{a})
+
+	Want(t, len(all["tags"].([]any)) == 2)
+}
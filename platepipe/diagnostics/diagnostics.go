@@ -0,0 +1,124 @@
+// Package diagnostics defines the error values returned by the platepipe
+// packages. Besides the human-readable message, these carry the location and
+// nature of the problem, so that tools such as editors and CI systems can
+// annotate the offending files.
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+)
+
+// Kind classifies errors by the processing step in which they happened.
+type Kind string
+
+// Known error kinds.
+const (
+	KindIO            Kind = "io"
+	KindMetadata      Kind = "metadata"
+	KindMarkdown      Kind = "markdown"
+	KindInclude       Kind = "include"
+	KindShortcode     Kind = "shortcode"
+	KindTemplateParse Kind = "template-parse"
+	KindTemplateExec  Kind = "template-exec"
+	KindRequirement   Kind = "requirement"
+	KindLint          Kind = "lint"
+)
+
+// Severity tells apart problems that stop processing from those that do not.
+type Severity string
+
+// Known severities.
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Error is an error located in a file, and possibly at a line and column of
+// that file. Line is 1-based, zero when unknown. Column is the byte offset in
+// the line, as reported by the Go template packages, and only meaningful when
+// Line is known.
+//
+// Stage is the index of the pipeline stage where the error happened: 0 for the
+// document, n for the n-th template. Documents and templates do not know their
+// place in a pipeline, so errors are created with Stage -1 and it is up to the
+// code running the pipeline to set it.
+type Error struct {
+	Kind     Kind
+	Severity Severity
+	File     string
+	Line     int
+	Column   int
+	Stage    int
+	Err      error
+}
+
+// New returns an error of the given kind, with error severity, located in
+// file. The line and column, if any, are left for the caller to fill in.
+func New(kind Kind, file string, err error) *Error {
+	return &Error{
+		Kind:     kind,
+		Severity: SeverityError,
+		File:     file,
+		Stage:    -1,
+		Err:      err,
+	}
+}
+
+// Error returns the message of the underlying error, which already contains
+// the location of the problem in human-readable form.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON encodes the error as a flat JSON object, with lowercase keys
+// and the error message under "message".
+//
+// Unlike json.Marshal, HTML characters in the message are not escaped, which
+// keeps messages readable for tools that display them verbatim.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	err := enc.Encode(struct {
+		File     string   `json:"file"`
+		Line     int      `json:"line"`
+		Column   int      `json:"column"`
+		Stage    int      `json:"stage"`
+		Severity Severity `json:"severity"`
+		Kind     Kind     `json:"kind"`
+		Message  string   `json:"message"`
+	}{
+		e.File, e.Line, e.Column, e.Stage, e.Severity, e.Kind, e.Error(),
+	})
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), err
+}
+
+// Locate looks in msg for the first position given as prefix followed by
+// "line" or "line:column" and returns the line and column, zero if not found.
+//
+// For example, template errors are located with the template name and a
+// colon as the prefix, and TOML errors with "line ".
+func Locate(msg, prefix string) (int, int) {
+	re := regexp.MustCompile(regexp.QuoteMeta(prefix) + `(\d+)(?::(\d+))?`)
+
+	m := re.FindStringSubmatch(msg)
+	if m == nil {
+		return 0, 0
+	}
+
+	line, _ := strconv.Atoi(m[1])
+	col, _ := strconv.Atoi(m[2])
+
+	return line, col
+}
@@ -0,0 +1,53 @@
+package diagnostics_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestError(t *testing.T) {
+	inner := fmt.Errorf("template: a.html:3:5: <b> is bad")
+	err := diagnostics.New(diagnostics.KindTemplateParse, "a.html", inner)
+
+	Want(t, err.Error() == inner.Error())
+	Want(t, errors.Is(err, inner))
+	Want(t, err.Severity == diagnostics.SeverityError)
+	Want(t, err.Stage == -1)
+
+	err.Line, err.Column = 3, 5
+	buf, jerr := err.MarshalJSON()
+
+	Need(t, jerr == nil)
+	Want(t, string(buf) == `{"file":"a.html","line":3,"column":5,`+
+		`"stage":-1,"severity":"error","kind":"template-parse",`+
+		`"message":"template: a.html:3:5: <b> is bad"}`)
+}
+
+func TestLocate(t *testing.T) {
+	cases := []struct {
+		msg    string
+		prefix string
+		line   int
+		col    int
+	}{
+		{"", "a.txt:", 0, 0},
+		{"no position here", "a.txt:", 0, 0},
+		{"template: a.txt:12: unexpected EOF", "a.txt:", 12, 0},
+		{"template: a.txt:12:7: executing", "a.txt:", 12, 7},
+		{"template: b.txt:1:1: a.txt:3:4", "a.txt:", 3, 4},
+		{"toml: line 5: expected '='", "line ", 5, 0},
+	}
+
+	for _, c := range cases {
+		line, col := diagnostics.Locate(c.msg, c.prefix)
+
+		if line != c.line || col != c.col {
+			t.Errorf("Locate(%q, %q) returned %d, %d",
+				c.msg, c.prefix, line, col)
+		}
+	}
+}
@@ -5,13 +5,35 @@
 // This package treats metadata blocks that fail to parse correctly as document
 // content. For additional details on the formats and processing of the
 // metadata headers, see the documentation for the metadata package.
+//
+// Documents may include other documents, with a line holding only an include
+// directive and the quoted path of the document to include, relative to the
+// including document:
+//
+//	@include "chapters/intro.md"
+//
+// The directive is replaced with the content of the included document, before
+// any conversion, and the metadata of the included document is made available
+// under the "includes" key of the including document's metadata, by path
+// (relative to the current directory), so the header of a document with
+// include directives must not define "includes". Included documents may
+// include other documents, but not themselves, directly or indirectly. Include
+// directives in fenced code blocks are not processed.
+//
+// The structure of Markdown documents, such as their headings and links, their
+// statistics and their summaries are extracted by Describe, Measure and
+// Summarize.
+//
+// Errors returned by this package are *diagnostics.Error values.
 package documents
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 
+	"cdop.pt/go/free/platepipe/diagnostics"
 	"cdop.pt/go/free/platepipe/documents/files"
 	"cdop.pt/go/free/platepipe/documents/markdown"
 	"cdop.pt/go/free/platepipe/metadata"
@@ -35,28 +57,67 @@ func FromFile(file string) ([]byte, map[string]any, error) {
 func FromMarkdownFile(file string) ([]byte, map[string]any, error) {
 	r, err := os.Open(file)
 	if err != nil {
-		return []byte{}, map[string]any{}, err
+		return []byte{}, map[string]any{},
+			diagnostics.New(diagnostics.KindIO, file, err)
 	}
 	defer r.Close()
 
-	return FromMarkdownStream(r)
+	return fromMarkdownStream(file, r)
 }
 
 // FromMarkdownStream loads content/metadata from the given io.Reader and
 // returns the Markdown content converted to HTML.
 func FromMarkdownStream(r io.Reader) ([]byte, map[string]any, error) {
-	buf, data, err := FromTextStream(r)
+	return fromMarkdownStream("", r)
+}
+
+func fromMarkdownStream(file string, r io.Reader) (
+	[]byte, map[string]any, error,
+) {
+	buf, data, err := fromTextStream(file, r)
 	if err != nil {
 		return []byte{}, map[string]any{}, err
 	}
 
-	var html bytes.Buffer
-	err = markdown.ToHTML(buf, &html)
+	html, err := MarkdownToHTML(nil, file, buf)
 	if err != nil {
 		return []byte{}, map[string]any{}, err
 	}
 
-	return html.Bytes(), data, err
+	return html, data, nil
+}
+
+// MarkdownToHTML converts the content of a document, loaded from file, from
+// Markdown to HTML, with conv, or markdown.ToHTML if nil. It allows content
+// loaded without conversion to be converted later, e.g., after processing it
+// further.
+func MarkdownToHTML(
+	conv *markdown.Converter, file string, buf []byte,
+) ([]byte, error) {
+	var html bytes.Buffer
+
+	err := conv.ToHTML(buf, &html)
+	if err != nil {
+		return []byte{}, diagnostics.New(diagnostics.KindMarkdown, file, err)
+	}
+
+	return html.Bytes(), nil
+}
+
+// Describe returns the structure of a Markdown document, buf, as extracted by
+// conv, or markdown.Inspect if nil, given its metadata, data. Its title is
+// taken from the "title" key of the metadata, if it is a string, falling back
+// to the first level 1 heading of the document.
+func Describe(
+	conv *markdown.Converter, buf []byte, data map[string]any,
+) map[string]any {
+	ret := conv.Inspect(buf)
+
+	if title, ok := data["title"].(string); ok {
+		ret["title"] = title
+	}
+
+	return ret
 }
 
 // FromTextFile loads content/metadata from the given file. No content
@@ -64,31 +125,81 @@ func FromMarkdownStream(r io.Reader) ([]byte, map[string]any, error) {
 func FromTextFile(file string) ([]byte, map[string]any, error) {
 	r, err := os.Open(file)
 	if err != nil {
-		return []byte{}, map[string]any{}, err
+		return []byte{}, map[string]any{},
+			diagnostics.New(diagnostics.KindIO, file, err)
 	}
 	defer r.Close()
 
-	return FromTextStream(r)
+	return fromTextStream(file, r)
 }
 
 // FromTextStream loads content/metadata from the given io.Reader. No content
 // conversion is made.
 func FromTextStream(r io.Reader) ([]byte, map[string]any, error) {
+	return fromTextStream("", r)
+}
+
+func fromTextStream(file string, r io.Reader) (
+	[]byte, map[string]any, error,
+) {
+	content, data, _, err := Read(file, r)
+	return content, data, err
+}
+
+// Read loads content/metadata from the given io.Reader, with the contents of
+// file, or standard input if file is empty, which is used to resolve include
+// directives and in errors. Like Split, it also returns the number of lines
+// taken by the metadata header. No content conversion is made.
+func Read(file string, r io.Reader) ([]byte, map[string]any, int, error) {
 	buf, err := io.ReadAll(r)
 	if err != nil {
-		return []byte{}, map[string]any{}, err
+		return []byte{}, map[string]any{}, 0,
+			diagnostics.New(diagnostics.KindIO, file, err)
 	}
 
+	content, data, line := Split(buf)
+
+	includes := map[string]any{}
+
+	content, err = expand(file, content, line, includes, nil)
+	if err != nil {
+		return []byte{}, map[string]any{}, 0, err
+	}
+
+	if len(includes) > 0 {
+		if _, ok := data["includes"]; ok {
+			name := file
+			if name == "" {
+				name = "-"
+			}
+
+			return []byte{}, map[string]any{}, 0, diagnostics.New(
+				diagnostics.KindMetadata, file, fmt.Errorf("%s: header "+
+					"variable %q is reserved for the metadata of included "+
+					"documents", name, "includes"))
+		}
+
+		data["includes"] = includes
+	}
+
+	return content, data, line, nil
+}
+
+// Split separates the metadata header from the content of buf. Besides the
+// content and the metadata, it returns the number of lines taken by the
+// header, which allows positions in the content to be mapped back to lines
+// in buf.
+func Split(buf []byte) ([]byte, map[string]any, int) {
 	present, splitPos := metadata.IsPresent(buf)
 	if !present {
-		return buf, map[string]any{}, nil
+		return buf, map[string]any{}, 0
 	}
 
 	data, err := metadata.FromTomlBuffer(buf[:splitPos])
 	if err != nil {
 		// treat parse error as document content, see metadata package doc
-		return buf, map[string]any{}, nil
+		return buf, map[string]any{}, 0
 	}
 
-	return buf[splitPos:], data, nil
+	return buf[splitPos:], data, bytes.Count(buf[:splitPos], []byte{'\n'})
 }
@@ -1,12 +1,16 @@
 package documents_test
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"testing/iotest"
 
+	"cdop.pt/go/free/platepipe/diagnostics"
 	"cdop.pt/go/free/platepipe/documents"
 	"cdop.pt/go/free/platepipe/documents/markdown"
 	. "cdop.pt/go/open/assertive"
@@ -51,6 +55,309 @@ func TestMarkdown(t *testing.T) {
 	})
 }
 
+func TestHeadingIDs(t *testing.T) {
+	md := "# Über Café\n\n## Über Café\n\n## Custom {#mine}\n\n## ½ & C++!\n"
+
+	cases := []struct {
+		config markdown.Config
+		html   string
+	}{
+		{
+			markdown.Config{},
+			"<h1>Über Café</h1>\n<h2>Über Café</h2>\n<h2>Custom {#mine}</h2>\n" +
+				"<h2>½ &amp; C++!</h2>\n",
+		},
+		{
+			markdown.Config{IDs: "github"},
+			`<h1 id="über-café">Über Café</h1>` + "\n" +
+				`<h2 id="über-café-1">Über Café</h2>` + "\n" +
+				`<h2 id="mine">Custom</h2>` + "\n" +
+				`<h2 id="--c">½ &amp; C++!</h2>` + "\n",
+		},
+		{
+			markdown.Config{IDs: "unicode"},
+			`<h1 id="über-café">Über Café</h1>` + "\n" +
+				`<h2 id="über-café-1">Über Café</h2>` + "\n" +
+				`<h2 id="mine">Custom</h2>` + "\n" +
+				`<h2 id="c">½ &amp; C++!</h2>` + "\n",
+		},
+		{
+			markdown.Config{IDs: "ascii", Anchor: "¶"},
+			`<h1 id="uber-cafe">Über Café <a href="#uber-cafe" class="anchor">` +
+				`¶</a></h1>` + "\n" +
+				`<h2 id="uber-cafe-1">Über Café <a href="#uber-cafe-1" ` +
+				`class="anchor">¶</a></h2>` + "\n" +
+				`<h2 id="mine">Custom <a href="#mine" class="anchor">¶</a></h2>` +
+				"\n" +
+				`<h2 id="c">½ &amp; C++! <a href="#c" class="anchor">¶</a></h2>` +
+				"\n",
+		},
+	}
+
+	defer func() { _ = markdown.Configure(markdown.Config{}) }()
+
+	for _, c := range cases {
+		t.Run(c.config.IDs, func(t *testing.T) {
+			Need(t, markdown.Configure(c.config) == nil)
+
+			html, err := documents.MarkdownToHTML(nil, "", []byte(md))
+
+			Need(t, err == nil)
+			Want(t, string(html) == c.html)
+		})
+	}
+
+	t.Run("structure", func(t *testing.T) {
+		Need(t, markdown.Configure(markdown.Config{IDs: "ascii", Anchor: "#"}) ==
+			nil)
+
+		doc := documents.Describe(nil, []byte(md+"\nSee [the docs](/docs).\n"),
+			map[string]any{})
+
+		h := doc["headings"].([]any)[0].(map[string]any)
+		Want(t, h["id"] == "uber-cafe")
+		Want(t, h["text"] == "Über Café")
+
+		links := doc["links"].([]any)
+		Need(t, len(links) == 1)
+		Want(t, links[0].(map[string]any)["url"] == "/docs")
+		Want(t, links[0].(map[string]any)["text"] == "the docs")
+	})
+
+	t.Run("settings", func(t *testing.T) {
+		c := markdown.Config{}
+
+		Want(t, c.Apply(map[string]any{"ids": "github", "anchor": "#"}) == nil)
+		Want(t, c.IDs == "github" && c.Anchor == "#")
+		Want(t, c.Apply(map[string]any{"ids": true}).Error() ==
+			`markdown setting "ids" must be a string, not bool`)
+		Want(t, c.Apply(map[string]any{"nope": ""}).Error() ==
+			`unknown markdown setting "nope"`)
+		Want(t, markdown.Configure(markdown.Config{IDs: "nope"}).Error() ==
+			`unknown slug rule "nope", expected one of: github, unicode, ascii`)
+	})
+}
+
+func TestMarkdownConfig(t *testing.T) {
+	md := "Hi <b>x</b> \"q\"...\nline\n\nText[^1]\n\n[^1]: note\n"
+
+	cases := []struct {
+		name     string
+		settings map[string]any
+		html     string
+	}{
+		{
+			"default",
+			map[string]any{},
+			"<p>Hi <!-- raw HTML omitted -->x<!-- raw HTML omitted --> " +
+				"&quot;q&quot;...\nline</p>\n<p>Text<a href=\"note\">^1</a></p>\n",
+		},
+		{
+			"renderer",
+			map[string]any{"unsafe": true, "hardwraps": true, "xhtml": true},
+			"<p>Hi <b>x</b> &quot;q&quot;...<br />\nline</p>\n" +
+				"<p>Text<a href=\"note\">^1</a></p>\n",
+		},
+		{
+			"extensions",
+			map[string]any{
+				"extensions":  "Typographer",
+				"typographer": map[string]any{"ldquo": "«", "rdquo": "»"},
+				"footnote":    map[string]any{"prefix": "d-", "backlink": "^"},
+			},
+			"<p>Hi <!-- raw HTML omitted -->x<!-- raw HTML omitted --> " +
+				"«q»&hellip;\nline</p>\n" +
+				`<p>Text<sup id="d-fnref:1"><a href="#d-fn:1" ` +
+				`class="footnote-ref" role="doc-noteref">1</a></sup></p>` + "\n" +
+				`<div class="footnotes" role="doc-endnotes">` + "\n<hr>\n<ol>\n" +
+				`<li id="d-fn:1">` + "\n" + `<p>note&#160;<a href="#d-fnref:1" ` +
+				`class="footnote-backref" role="doc-backlink">^</a></p>` +
+				"\n</li>\n</ol>\n</div>\n",
+		},
+	}
+
+	defer func() { _ = markdown.Configure(markdown.Config{}) }()
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := markdown.Config{}
+			Need(t, config.Apply(c.settings) == nil)
+			Need(t, markdown.Configure(config) == nil)
+
+			html, err := documents.MarkdownToHTML(nil, "", []byte(md))
+
+			Need(t, err == nil)
+			Want(t, string(html) == c.html)
+		})
+	}
+
+	errs := []struct {
+		settings map[string]any
+		msg      string
+	}{
+		{map[string]any{"unsafe": "yes"},
+			`markdown setting "unsafe" must be a boolean, not string`},
+		{map[string]any{"extensions": []any{"gfm", "nope"}},
+			`unknown markdown extension "nope", expected one of: cjk, ` +
+				`definitionlist, footnote, gfm, linkify, strikethrough, table, ` +
+				`tasklist, typographer`},
+		{map[string]any{"typographer": map[string]any{"quot": "'"}},
+			`unknown typographer substitution "quot", expected one of: apos, ` +
+				`hellip, laquo, ldquo, lsquo, mdash, ndash, raquo, rdquo, rsquo`},
+		{map[string]any{"footnote": map[string]any{"suffix": "-"}},
+			`unknown markdown setting "footnote.suffix"`},
+	}
+
+	for _, c := range errs {
+		config := markdown.Config{}
+
+		err := config.Apply(c.settings)
+		if err == nil {
+			err = markdown.Configure(config)
+		}
+
+		Need(t, err != nil)
+		Want(t, err.Error() == c.msg)
+	}
+
+	t.Run("documents", func(t *testing.T) {
+		Need(t, markdown.Configure(markdown.Config{
+			HardWraps:   true,
+			Typographer: map[string]string{"ldquo": "«"},
+		}) == nil)
+		defer func() { _ = markdown.Configure(markdown.Config{}) }()
+
+		convert := func(data map[string]any) string {
+			conv, err := markdown.ForDocument(data)
+			Need(t, err == nil)
+
+			html, err := documents.MarkdownToHTML(conv, "", []byte(`"a"`+"\nb"))
+			Need(t, err == nil)
+
+			return string(html)
+		}
+
+		conv, err := markdown.ForDocument(map[string]any{})
+		Want(t, conv == nil && err == nil)
+
+		Want(t, convert(map[string]any{}) == "<p>«a&rdquo;<br>\nb</p>\n")
+		Want(t, convert(map[string]any{"markdown": map[string]any{
+			"hardwraps": false, "typographer": map[string]any{"rdquo": "»"},
+		}}) == "<p>«a»\nb</p>\n")
+		Want(t, len(markdown.Defaults.Typographer) == 1)
+		Want(t, convert(map[string]any{}) == "<p>«a&rdquo;<br>\nb</p>\n")
+
+		_, err = markdown.ForDocument(map[string]any{"markdown": true})
+		Want(t, err.Error() == "markdown settings must be a table, not bool")
+	})
+}
+
+func TestSummarize(t *testing.T) {
+	cases := []struct {
+		name    string
+		words   int
+		content string
+		summary string
+	}{
+		{
+			"whole",
+			5,
+			"<p>One two.</p>\n",
+			"<p>One two.</p>\n",
+		},
+		{
+			"paragraphs",
+			5,
+			"<p>One two.</p>\n<p>Three <em>four</em> five six.</p>\n",
+			"<p>One two.</p>",
+		},
+		{
+			"sentences",
+			5,
+			"<p>One <b>two. Three</b> four! Five six. Seven.</p>",
+			"<p>One <b>two. Three</b> four!</p>",
+		},
+		{
+			"open elements",
+			4,
+			"<p>One <b>two. Three four five</b> six.</p>",
+			"<p>One <b>two.</b></p>",
+		},
+		{
+			"words",
+			3,
+			"<p>One <a href=\"#\">two, three four</a> five.</p>",
+			"<p>One <a href=\"#\">two, three…</a></p>",
+		},
+		{
+			"first paragraph",
+			0,
+			"<h1>T</h1>\n<p>One. Two.</p>\n<p>Three.</p>",
+			"<p>One. Two.</p>",
+		},
+	}
+
+	defer func(words int) { documents.SummaryWords = words }(
+		documents.SummaryWords)
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			documents.SummaryWords = c.words
+
+			summary := documents.Summarize([]byte(c.content), nil)
+
+			Want(t, fmt.Sprint(summary["html"]) == c.summary)
+			Want(t, summary["truncated"] == (c.summary != c.content))
+		})
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	cases := []struct {
+		name    string
+		file    string
+		content string
+		isHTML  bool
+		title   string
+		stats   map[string]any
+	}{
+		{
+			"empty", "", "", false, "",
+			map[string]any{"wordCount": 0, "characterCount": 0,
+				"headingCount": 0, "readingTime": 0, "slug": "", "script": ""},
+		},
+		{
+			"text", "docs/Über Uns.txt", "Ein kurzer Text, über uns.\n", false,
+			"",
+			map[string]any{"wordCount": 5, "characterCount": 22,
+				"headingCount": 0, "readingTime": 1, "slug": "uber-uns",
+				"script": "latin"},
+		},
+		{
+			"punctuation", "", "Well-known — don't «stop»!", false, "",
+			map[string]any{"wordCount": 3, "characterCount": 23,
+				"headingCount": 0, "readingTime": 1, "slug": "",
+				"script": "latin"},
+		},
+		{
+			"cjk", "doc.html", "<h1>日本語</h1>\n<p>これは テストです。</p>", true,
+			"Nihongo",
+			map[string]any{"wordCount": 11, "characterCount": 12,
+				"headingCount": 1, "readingTime": 1, "slug": "nihongo",
+				"script": "cjk"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stats := documents.Measure(c.file, []byte(c.content), c.isHTML,
+				c.title)
+
+			Want(t, fmt.Sprint(stats) == fmt.Sprint(c.stats))
+		})
+	}
+}
+
 func TestText(t *testing.T) {
 	t.Run("no file", func(t *testing.T) {
 		_, _, err := documents.FromFile("non-existent-file.txt")
@@ -94,6 +401,45 @@ func TestText(t *testing.T) {
 	})
 }
 
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		buf     string
+		content string
+		keys    int
+		line    int
+	}{
+		{"", "", 0, 0},
+		{"no metadata", "no metadata", 0, 0},
+		{"key: value\n\ntext", "key: value\n\ntext", 0, 0},
+		{"key = 'value'\n\ntext", "text", 1, 2},
+		{"a = 1\nb = 2\r\n\r\ntext\n", "text\n", 2, 3},
+	}
+
+	for _, c := range cases {
+		content, data, line := documents.Split([]byte(c.buf))
+
+		Want(t, string(content) == c.content)
+		Want(t, len(data) == c.keys)
+		Want(t, line == c.line)
+	}
+}
+
+func TestRead(t *testing.T) {
+	buf := "key = 'value'\n\n# {{ .key }}\n"
+
+	content, data, line, err := documents.Read("", strings.NewReader(buf))
+
+	Need(t, err == nil)
+	Want(t, string(content) == "# {{ .key }}\n")
+	Want(t, fmt.Sprint(data) == fmt.Sprint(map[string]any{"key": "value"}))
+	Want(t, line == 2)
+
+	html, err := documents.MarkdownToHTML(nil, "", content)
+
+	Need(t, err == nil)
+	Want(t, string(html) == "<h1>{{ .key }}</h1>\n")
+}
+
 func TestReadErrors(t *testing.T) {
 	msg := "error reading document"
 	r := iotest.ErrReader(fmt.Errorf(msg))
@@ -121,3 +467,72 @@ func mkTestFile(t *testing.T, pattern, content string) string {
 
 	return name
 }
+
+func TestIncludes(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		Need(t, os.MkdirAll(filepath.Dir(p), 0o700) == nil)
+		Need(t, os.WriteFile(p, []byte(content), 0o600) == nil)
+		return p
+	}
+
+	doc := write("doc.md", "title = 'doc'\n\n# Manual\n\n"+
+		"@include \"parts/one.md\"\n\n```\n@include \"nope.md\"\n```\n")
+	write("parts/one.md", "title = 'one'\n\n## One\n@include \"two.txt\"")
+	write("parts/two.txt", "two")
+	missing := write("missing.txt", "a\n\nb\n@include \"parts/bad.txt\"\n")
+	write("parts/bad.txt", "@include \"nope.txt\"\n")
+	cycle := write("cycle.txt", "@include \"parts/cycle.txt\"\n")
+	reserved := write("reserved.md", "includes = ['x']\n\n"+
+		"@include \"parts/two.txt\"\n")
+	write("parts/cycle.txt", "x\n@include \"../cycle.txt\"\n")
+
+	t.Run("success", func(t *testing.T) {
+		text, data, err := documents.FromFile(doc)
+
+		Need(t, err == nil)
+		Want(t, string(text) == "<h1>Manual</h1>\n<h2>One</h2>\n<p>two</p>\n"+
+			"<pre><code>@include &quot;nope.md&quot;\n</code></pre>\n")
+		Want(t, fmt.Sprint(data) == fmt.Sprint(map[string]any{
+			"title": "doc",
+			"includes": map[string]any{
+				filepath.Join(dir, "parts/one.md"):  map[string]any{"title": "one"},
+				filepath.Join(dir, "parts/two.txt"): map[string]any{},
+			},
+		}))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, _, err := documents.FromFile(missing)
+
+		var d *diagnostics.Error
+		Need(t, errors.As(err, &d))
+		Want(t, d.Kind == diagnostics.KindInclude)
+		Want(t, d.File == filepath.Join(dir, "parts/bad.txt"))
+		Want(t, d.Line == 1)
+		Want(t, strings.HasSuffix(err.Error(), "no such file or directory "+
+			"(include stack: "+dir+"/parts/bad.txt:1 <- "+missing+":4)"))
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		_, _, err := documents.FromFile(cycle)
+
+		Need(t, err != nil)
+		Want(t, err.Error() == dir+"/parts/cycle.txt:2: include cycle, "+
+			cycle+" includes itself (include stack: "+dir+"/parts/cycle.txt:2"+
+			" <- "+cycle+":1)")
+	})
+
+	t.Run("reserved key", func(t *testing.T) {
+		_, _, err := documents.FromFile(reserved)
+
+		var d *diagnostics.Error
+		Need(t, errors.As(err, &d))
+		Want(t, d.Kind == diagnostics.KindMetadata)
+		Want(t, d.File == reserved)
+		Want(t, err.Error() == reserved+`: header variable "includes" is `+
+			"reserved for the metadata of included documents")
+	})
+}
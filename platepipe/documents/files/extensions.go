@@ -1,4 +1,5 @@
-// Package files provides utility functions over document/template files.
+// Package files provides utility functions over document/template files,
+// such as telling their formats apart and getting information about them.
 package files
 
 import (
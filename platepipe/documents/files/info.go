@@ -0,0 +1,133 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Epoch, if not zero, is the latest modification time reported by Info, so
+// that modification times, which depend on when files were checked out, do
+// not change the output of reproducible builds, as recommended for
+// SOURCE_DATE_EPOCH by the Reproducible Builds project.
+var Epoch time.Time
+
+// Info returns information about a file, given its path and the root
+// directory of the input files, as a map with the following keys:
+//
+//	path     the path of the file, as given
+//	relative the path of the file relative to root, with forward slashes
+//	dir      the directory of relative, "." for files directly in root
+//	name     the base name of the file without its extension
+//	ext      the extension of the file, including the dot
+//	size     the size of the file, in bytes
+//	modified the modification time of the file, see Epoch
+func Info(path, root string) (map[string]any, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(absRoot, abs)
+	if err != nil {
+		return nil, err
+	}
+
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+
+	modified := stat.ModTime()
+	if !Epoch.IsZero() && modified.After(Epoch) {
+		modified = Epoch
+	}
+
+	return map[string]any{
+		"path":     path,
+		"relative": filepath.ToSlash(rel),
+		"dir":      filepath.ToSlash(filepath.Dir(rel)),
+		"name":     strings.TrimSuffix(base, ext),
+		"ext":      ext,
+		"size":     stat.Size(),
+		"modified": modified,
+	}, nil
+}
+
+// GitInfo returns information about the history of a file from git, which it
+// runs in the directory of the file, as a map with the following keys:
+//
+//	first   the first commit of the file
+//	last    the last commit of the file
+//	commits the number of commits of the file
+//
+// Commits are maps with the keys hash, date (the author date), author and
+// email. The history of renamed files is followed. GitInfo returns nil for
+// files with no commits, e.g., untracked files or files outside of git
+// repositories.
+func GitInfo(path string) (map[string]any, error) {
+	cmd := exec.Command("git", "log", "--follow",
+		"--format=%H%x00%aI%x00%an%x00%ae", "--", filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "not a git repository") {
+			return nil, nil
+		}
+
+		if msg == "" {
+			return nil, fmt.Errorf("git log %s: %w", path, err)
+		}
+		return nil, fmt.Errorf("git log %s: %w: %s", path, err, msg)
+	}
+
+	commits := []map[string]any{}
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		fields := strings.Split(s.Text(), "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+
+		date, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("git log %s: %w", path, err)
+		}
+
+		commits = append(commits, map[string]any{
+			"hash":   fields[0],
+			"date":   date,
+			"author": fields[2],
+			"email":  fields[3],
+		})
+	}
+
+	if len(commits) == 0 {
+		return nil, nil
+	}
+
+	return map[string]any{
+		"first":   commits[len(commits)-1],
+		"last":    commits[0],
+		"commits": len(commits),
+	}, nil
+}
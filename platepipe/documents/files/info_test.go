@@ -0,0 +1,115 @@
+package files_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cdop.pt/go/free/platepipe/documents/files"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestInfo(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "posts", "hello.world.md")
+
+	Need(t, os.MkdirAll(filepath.Dir(p), 0o700) == nil)
+	Need(t, os.WriteFile(p, []byte("hello"), 0o600) == nil)
+
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	Need(t, os.Chtimes(p, mtime, mtime) == nil)
+
+	info, err := files.Info(p, root)
+
+	Need(t, err == nil)
+	Want(t, info["path"] == p)
+	Want(t, info["relative"] == "posts/hello.world.md")
+	Want(t, info["dir"] == "posts")
+	Want(t, info["name"] == "hello.world")
+	Want(t, info["ext"] == ".md")
+	Want(t, info["size"] == int64(5))
+	Want(t, info["modified"].(time.Time).Equal(mtime))
+
+	_, err = files.Info(filepath.Join(root, "nope.md"), root)
+
+	Want(t, os.IsNotExist(err))
+}
+
+func TestGitInfo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "doc.md")
+
+	git := func(date string, args ...string) {
+		cmd := exec.Command("git", append([]string{
+			"-c", "user.name=A", "-c", "user.email=a@example.com",
+			"-c", "commit.gpgsign=false",
+		}, args...)...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Log(string(out))
+		}
+		Need(t, err == nil)
+	}
+
+	git("2024-01-01T00:00:00Z", "init", "-q")
+
+	Need(t, os.WriteFile(p, []byte("1"), 0o600) == nil)
+	git("2024-01-02T03:04:05Z", "add", "doc.md")
+	git("2024-01-02T03:04:05Z", "commit", "-q", "-m", "first")
+
+	Need(t, os.WriteFile(p, []byte("2"), 0o600) == nil)
+	git("2024-02-03T04:05:06Z", "commit", "-q", "-a", "-m", "second")
+
+	info, err := files.GitInfo(p)
+
+	Need(t, err == nil)
+	Want(t, info["commits"] == 2)
+
+	first := info["first"].(map[string]any)
+	last := info["last"].(map[string]any)
+	Want(t, first["date"].(time.Time).Equal(
+		time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+	Want(t, last["date"].(time.Time).Equal(
+		time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)))
+	Want(t, last["author"] == "A" && last["email"] == "a@example.com")
+
+	untracked := filepath.Join(dir, "new.md")
+	Need(t, os.WriteFile(untracked, []byte("3"), 0o600) == nil)
+
+	info, err = files.GitInfo(untracked)
+
+	Need(t, err == nil)
+	Want(t, info == nil)
+}
+
+func TestInfoEpoch(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "doc.md")
+	Need(t, os.WriteFile(p, []byte("hello"), 0o600) == nil)
+
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	files.Epoch = epoch
+	defer func() { files.Epoch = time.Time{} }()
+
+	info, err := files.Info(p, ".")
+
+	Need(t, err == nil)
+	Want(t, info["modified"].(time.Time).Equal(epoch))
+
+	mtime := time.Date(2019, 5, 6, 7, 8, 9, 0, time.UTC)
+	Need(t, os.Chtimes(p, mtime, mtime) == nil)
+
+	info, err = files.Info(p, ".")
+
+	Need(t, err == nil)
+	Want(t, info["modified"].(time.Time).Equal(mtime))
+}
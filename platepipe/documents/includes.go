@@ -0,0 +1,130 @@
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+)
+
+var includeRegexp = regexp.MustCompile(`^@include\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// inclusion is a line of a document with an include directive.
+type inclusion struct {
+	file string
+	line int
+}
+
+func (inc inclusion) String() string {
+	return fmt.Sprintf("%s:%d", inc.name(), inc.line)
+}
+
+func (inc inclusion) name() string {
+	if inc.file == "" {
+		return "-"
+	}
+
+	return inc.file
+}
+
+// expand replaces the include directives in the content of a document with
+// the content of the included documents, recursively, and collects their
+// metadata in includes, by path. The content starts after line lines of file
+// (i.e., its metadata header), and stack holds the directives that led to
+// including file.
+func expand(
+	file string, content []byte, line int,
+	includes map[string]any, stack []inclusion,
+) ([]byte, error) {
+	if !bytes.Contains(content, []byte("@include")) {
+		return content, nil
+	}
+
+	lines := bytes.SplitAfter(content, []byte{'\n'})
+
+	out := new(bytes.Buffer)
+	fence := ""
+
+	for i, l := range lines {
+		text := strings.TrimRight(string(l), "\r\n")
+
+		trimmed := strings.TrimLeft(text, " ")
+		if len(text)-len(trimmed) < 4 {
+			switch {
+			case fence != "" && strings.HasPrefix(trimmed, fence):
+				fence = ""
+			case fence == "" && strings.HasPrefix(trimmed, "```"):
+				fence = "```"
+			case fence == "" && strings.HasPrefix(trimmed, "~~~"):
+				fence = "~~~"
+			}
+		}
+
+		m := includeRegexp.FindStringSubmatch(text)
+		if fence != "" || m == nil {
+			out.Write(l)
+			continue
+		}
+
+		here := inclusion{file, line + i + 1}
+		path, _ := strconv.Unquote(m[1])
+
+		buf, err := include(here, path, includes, stack)
+		if err != nil {
+			return nil, err
+		}
+
+		out.Write(buf)
+		if len(buf) > 0 && buf[len(buf)-1] != '\n' {
+			out.WriteByte('\n')
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// include returns the expanded content of the document at path, relative to
+// the document with the directive.
+func include(
+	here inclusion, path string,
+	includes map[string]any, stack []inclusion,
+) ([]byte, error) {
+	file := filepath.Join(filepath.Dir(here.file), path)
+	stack = append(stack, here)
+
+	fail := func(format string, args ...any) error {
+		from := make([]string, len(stack))
+		for i, inc := range stack {
+			from[len(stack)-1-i] = inc.String()
+		}
+
+		e := diagnostics.New(diagnostics.KindInclude, here.file, fmt.Errorf(
+			"%s: "+format+" (include stack: %s)",
+			append(append([]any{here}, args...),
+				strings.Join(from, " <- "))...))
+		e.Line = here.line
+
+		return e
+	}
+
+	for _, inc := range stack {
+		if inc.file != "" && filepath.Clean(inc.file) == file {
+			return nil, fail("include cycle, %s includes itself", file)
+		}
+	}
+
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fail("cannot include %q: %w", path, err)
+	}
+
+	content, data, line := Split(buf)
+	includes[file] = data
+
+	return expand(file, content, line, includes, stack)
+}
@@ -0,0 +1,504 @@
+package markdown
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Config configures the default Markdown procedures, ToHTML and Inspect,
+// implemented with goldmark, see Configure, or the converter of a document,
+// see ForDocument.
+type Config struct {
+	// IDs is the slug rule used to generate unique heading IDs, see Slug, or
+	// empty for no heading IDs. When heading IDs are enabled, headings may
+	// also set their IDs explicitly, e.g., "## Install {#setup}".
+	IDs string
+
+	// Anchor is the text of the permalink anchors appended to headings with
+	// IDs, e.g., "¶", or empty for no anchors. Anchors are rendered as
+	// <a class="anchor" href="#id">¶</a>.
+	Anchor string
+
+	// Unsafe renders raw HTML and links with potentially dangerous URLs,
+	// which are replaced with comments otherwise.
+	Unsafe bool
+
+	// HardWraps renders newlines in paragraphs as line breaks.
+	HardWraps bool
+
+	// XHTML renders void elements in XHTML style, e.g., <br />.
+	XHTML bool
+
+	// Attributes enables attributes for headings, e.g.,
+	// "## Install {.important}", which are enabled along with IDs anyway.
+	Attributes bool
+
+	// Extensions are the names of the goldmark extensions to enable, see
+	// ExtensionNames.
+	Extensions []string
+
+	// Typographer replaces the substitutions of the typographer extension,
+	// by the HTML entity name of the default substitution, see
+	// TypographerNames, e.g., "ldquo" for “. Setting substitutions enables
+	// the extension.
+	Typographer map[string]string
+
+	// FootnotePrefix prefixes the IDs of footnotes, e.g., to tell apart the
+	// footnotes of documents rendered into the same page. FootnoteBacklink is
+	// the HTML of the links back from footnotes to their references, "↩︎" by
+	// default. Setting either enables the footnote extension.
+	FootnotePrefix   string
+	FootnoteBacklink string
+}
+
+// ExtensionNames are the names of the known goldmark extensions, see
+// Config.Extensions.
+var ExtensionNames = []string{
+	"cjk", "definitionlist", "footnote", "gfm", "linkify", "strikethrough",
+	"table", "tasklist", "typographer",
+}
+
+// TypographerNames are the names of the typographer substitutions, see
+// Config.Typographer.
+var TypographerNames = []string{
+	"apos", "hellip", "laquo", "ldquo", "lsquo", "mdash", "ndash", "raquo",
+	"rdquo", "rsquo",
+}
+
+var typographerPunctuation = map[string]extension.TypographicPunctuation{
+	"lsquo":  extension.LeftSingleQuote,
+	"rsquo":  extension.RightSingleQuote,
+	"ldquo":  extension.LeftDoubleQuote,
+	"rdquo":  extension.RightDoubleQuote,
+	"ndash":  extension.EnDash,
+	"mdash":  extension.EmDash,
+	"hellip": extension.Ellipsis,
+	"laquo":  extension.LeftAngleQuote,
+	"raquo":  extension.RightAngleQuote,
+	"apos":   extension.Apostrophe,
+}
+
+// Apply sets the fields of c from the given settings, by name, as they may be
+// given in a metadata header or a configuration file, e.g.,
+// markdown.ids = "github". The names are the lower case names of the fields,
+// except for typographer and footnote, which are tables, e.g.,
+// markdown.typographer.ldquo = "«" and markdown.footnote.prefix = "a-".
+// Extensions may be given as an array or as a comma-separated string.
+// Typographer substitutions are added to those already set, other settings
+// are replaced. Unknown names and values of the wrong type are errors.
+func (c *Config) Apply(settings map[string]any) error {
+	for _, k := range sortedKeys(settings) {
+		v := settings[k]
+
+		var err error
+
+		switch k {
+		case "ids":
+			err = setString(&c.IDs, k, v)
+		case "anchor":
+			err = setString(&c.Anchor, k, v)
+		case "unsafe":
+			err = setBool(&c.Unsafe, k, v)
+		case "hardwraps":
+			err = setBool(&c.HardWraps, k, v)
+		case "xhtml":
+			err = setBool(&c.XHTML, k, v)
+		case "attributes":
+			err = setBool(&c.Attributes, k, v)
+		case "extensions":
+			err = setList(&c.Extensions, k, v)
+		case "typographer":
+			err = c.applyTypographer(v)
+		case "footnote":
+			err = c.applyFootnote(v)
+		default:
+			err = fmt.Errorf("unknown markdown setting %q", k)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) applyTypographer(v any) error {
+	table, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("markdown setting %q must be a table, not %T",
+			"typographer", v)
+	}
+
+	if c.Typographer == nil {
+		c.Typographer = map[string]string{}
+	}
+
+	for _, k := range sortedKeys(table) {
+		var s string
+
+		err := setString(&s, "typographer."+k, table[k])
+		if err != nil {
+			return err
+		}
+		c.Typographer[k] = s
+	}
+
+	return nil
+}
+
+func (c *Config) applyFootnote(v any) error {
+	table, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("markdown setting %q must be a table, not %T",
+			"footnote", v)
+	}
+
+	for _, k := range sortedKeys(table) {
+		var err error
+
+		switch k {
+		case "prefix":
+			err = setString(&c.FootnotePrefix, "footnote."+k, table[k])
+		case "backlink":
+			err = setString(&c.FootnoteBacklink, "footnote."+k, table[k])
+		default:
+			err = fmt.Errorf("unknown markdown setting %q", "footnote."+k)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setString(field *string, name string, v any) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("markdown setting %q must be a string, not %T",
+			name, v)
+	}
+	*field = s
+
+	return nil
+}
+
+func setBool(field *bool, name string, v any) error {
+	b, ok := v.(bool)
+	if !ok {
+		return fmt.Errorf("markdown setting %q must be a boolean, not %T",
+			name, v)
+	}
+	*field = b
+
+	return nil
+}
+
+func setList(field *[]string, name string, v any) error {
+	switch v := v.(type) {
+	case string:
+		*field = []string{}
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				*field = append(*field, strings.ToLower(s))
+			}
+		}
+
+		return nil
+
+	case []any:
+		ret := []string{}
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return fmt.Errorf("markdown setting %q must be an array of "+
+					"strings, not of %T", name, e)
+			}
+			ret = append(ret, strings.ToLower(s))
+		}
+		*field = ret
+
+		return nil
+	}
+
+	return fmt.Errorf("markdown setting %q must be an array or a string, "+
+		"not %T", name, v)
+}
+
+func sortedKeys(m map[string]any) []string {
+	ret := []string{}
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+
+	return ret
+}
+
+// Defaults is the configuration of ToHTML and Inspect, as last set by
+// Configure, which documents without Markdown settings of their own are
+// converted with, see ForDocument.
+var Defaults Config
+
+// ForDocument returns the converter of a document with the given metadata,
+// configured by Defaults overridden by the settings under its "markdown" key,
+// see Config.Apply, or nil, standing for ToHTML and Inspect, if it has no
+// settings.
+func ForDocument(data map[string]any) (*Converter, error) {
+	settings, ok := data["markdown"]
+	if !ok {
+		return nil, nil
+	}
+
+	table, ok := settings.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("markdown settings must be a table, not %T",
+			settings)
+	}
+
+	c := Defaults
+	c.Typographer = map[string]string{}
+	for k, v := range Defaults.Typographer {
+		c.Typographer[k] = v
+	}
+
+	err := c.Apply(table)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Converter()
+}
+
+// Converter converts Markdown documents to HTML and extracts their structure,
+// like ToHTML and Inspect, with a configuration of its own, see
+// Config.Converter. A nil *Converter uses ToHTML and Inspect.
+type Converter struct {
+	toHTML  func([]byte, io.Writer) error
+	inspect func([]byte) map[string]any
+}
+
+// ToHTML converts a Markdown document, buf, to HTML, written to w.
+func (conv *Converter) ToHTML(buf []byte, w io.Writer) error {
+	if conv == nil {
+		return ToHTML(buf, w)
+	}
+
+	return conv.toHTML(buf, w)
+}
+
+// Inspect returns the structure of a Markdown document, buf, see Structure.
+func (conv *Converter) Inspect(buf []byte) map[string]any {
+	if conv == nil {
+		return Inspect(buf)
+	}
+
+	return conv.inspect(buf)
+}
+
+// Configure sets ToHTML and Inspect to procedures implemented with goldmark,
+// configured by c, see Config.Converter, and sets Defaults to c.
+//
+// Changing the configuration should be done as early as possible in the main
+// program, like swapping the procedures.
+func Configure(c Config) error {
+	conv, err := c.Converter()
+	if err != nil {
+		return err
+	}
+
+	ToHTML, Inspect, Defaults = conv.toHTML, conv.inspect, c
+
+	return nil
+}
+
+// Converter returns a converter implemented with goldmark, configured by c.
+// Unknown slug rules, extensions and typographer substitutions are errors.
+func (c Config) Converter() (*Converter, error) {
+	if c.IDs != "" && !contains(SlugRules, c.IDs) {
+		return nil, fmt.Errorf("unknown slug rule %q, expected one of: %s",
+			c.IDs, strings.Join(SlugRules, ", "))
+	}
+
+	exts, err := c.extenders()
+	if err != nil {
+		return nil, err
+	}
+
+	parserOpts := []parser.Option{}
+	if c.Attributes || c.IDs != "" {
+		parserOpts = append(parserOpts, parser.WithAttribute())
+	}
+
+	if c.IDs != "" {
+		parserOpts = append(parserOpts, parser.WithAutoHeadingID())
+
+		if c.Anchor != "" {
+			parserOpts = append(parserOpts, parser.WithASTTransformers(
+				util.Prioritized(anchors(c.Anchor), 100)))
+		}
+	}
+
+	rendererOpts := []renderer.Option{}
+	if c.Unsafe {
+		rendererOpts = append(rendererOpts, html.WithUnsafe())
+	}
+	if c.HardWraps {
+		rendererOpts = append(rendererOpts, html.WithHardWraps())
+	}
+	if c.XHTML {
+		rendererOpts = append(rendererOpts, html.WithXHTML())
+	}
+
+	gm := goldmark.New(
+		goldmark.WithExtensions(exts...),
+		goldmark.WithParserOptions(parserOpts...),
+		goldmark.WithRendererOptions(rendererOpts...),
+	)
+
+	context := func() parser.Context {
+		if c.IDs == "" {
+			return parser.NewContext()
+		}
+
+		return parser.NewContext(parser.WithIDs(&ids{c.IDs, map[string]bool{}}))
+	}
+
+	return &Converter{
+		toHTML: func(buf []byte, w io.Writer) error {
+			return gm.Convert(buf, w, parser.WithContext(context()))
+		},
+		inspect: func(buf []byte) map[string]any {
+			doc := gm.Parser().Parse(text.NewReader(buf),
+				parser.WithContext(context()))
+
+			return Structure(doc, buf)
+		},
+	}, nil
+}
+
+// extenders returns the goldmark extensions configured by c.
+func (c *Config) extenders() ([]goldmark.Extender, error) {
+	enabled := map[string]bool{
+		"typographer": len(c.Typographer) > 0,
+		"footnote":    c.FootnotePrefix != "" || c.FootnoteBacklink != "",
+	}
+
+	for _, name := range c.Extensions {
+		if !contains(ExtensionNames, name) {
+			return nil, fmt.Errorf("unknown markdown extension %q, expected "+
+				"one of: %s", name, strings.Join(ExtensionNames, ", "))
+		}
+		enabled[name] = true
+	}
+
+	names := []string{}
+	for name := range c.Typographer {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	substitutions := map[extension.TypographicPunctuation]string{}
+	for _, name := range names {
+		s := c.Typographer[name]
+		p, ok := typographerPunctuation[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown typographer substitution %q, "+
+				"expected one of: %s", name, strings.Join(TypographerNames, ", "))
+		}
+		substitutions[p] = s
+	}
+
+	footnoteOpts := []extension.FootnoteOption{}
+	if c.FootnotePrefix != "" {
+		footnoteOpts = append(footnoteOpts,
+			extension.WithFootnoteIDPrefix(c.FootnotePrefix))
+	}
+	if c.FootnoteBacklink != "" {
+		footnoteOpts = append(footnoteOpts,
+			extension.WithFootnoteBacklinkHTML(c.FootnoteBacklink))
+	}
+
+	ret := []goldmark.Extender{}
+
+	for _, name := range ExtensionNames {
+		if !enabled[name] {
+			continue
+		}
+
+		switch name {
+		case "cjk":
+			ret = append(ret, extension.CJK)
+		case "definitionlist":
+			ret = append(ret, extension.DefinitionList)
+		case "footnote":
+			ret = append(ret, extension.NewFootnote(footnoteOpts...))
+		case "gfm":
+			ret = append(ret, extension.GFM)
+		case "linkify":
+			ret = append(ret, extension.Linkify)
+		case "strikethrough":
+			ret = append(ret, extension.Strikethrough)
+		case "table":
+			ret = append(ret, extension.Table)
+		case "tasklist":
+			ret = append(ret, extension.TaskList)
+		case "typographer":
+			ret = append(ret, extension.NewTypographer(
+				extension.WithTypographicSubstitutions(substitutions)))
+		}
+	}
+
+	return ret, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// anchors is an AST transformer which appends permalink anchors with the
+// given text to headings with IDs.
+type anchors string
+
+func (a anchors) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		h, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+
+		id, ok := h.AttributeString("id")
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+
+		link := ast.NewLink()
+		link.Destination = append([]byte("#"), id.([]byte)...)
+		link.SetAttributeString("class", []byte("anchor"))
+		link.AppendChild(link, ast.NewString([]byte(a)))
+
+		h.AppendChild(h, ast.NewString([]byte(" ")))
+		h.AppendChild(h, link)
+
+		return ast.WalkSkipChildren, nil
+	})
+}
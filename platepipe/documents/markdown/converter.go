@@ -1,12 +1,9 @@
 // Package markdown defines the name, signature and default implementation of
-// the Markdown conversion procedure.
+// the Markdown conversion procedure, and of the procedure extracting the
+// structure of Markdown documents.
 package markdown
 
-import (
-	"io"
-
-	"github.com/yuin/goldmark"
-)
+import "io"
 
 // ToHTML is the default Markdown conversion procedure.
 //
@@ -18,9 +15,5 @@ import (
 var ToHTML func([]byte, io.Writer) error
 
 func init() {
-	gm := goldmark.New()
-
-	ToHTML = func(buf []byte, w io.Writer) error {
-		return gm.Convert(buf, w)
-	}
+	_ = Configure(Config{})
 }
@@ -0,0 +1,108 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// SlugRules are the known slug rules, see Slug.
+var SlugRules = []string{"github", "unicode", "ascii"}
+
+// asciiFolds maps common Latin letters with diacritics to ASCII.
+var asciiFolds = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae",
+	"ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e", "ì", "i", "í", "i",
+	"î", "i", "ï", "i", "ñ", "n", "ò", "o", "ó", "o", "ô", "o", "õ", "o",
+	"ö", "o", "ø", "o", "œ", "oe", "ß", "ss", "ù", "u", "ú", "u", "û", "u",
+	"ü", "u", "ý", "y", "ÿ", "y",
+)
+
+// Slug returns a slug for s, suitable for IDs and URLs, according to one of
+// the following rules:
+//
+//	github  like GitHub, lower case letters, digits, "-" and "_", with spaces
+//	        replaced with "-" and anything else removed
+//	unicode lower case letters and digits, with runs of anything else
+//	        replaced with a single "-"
+//	ascii   like unicode, but with common Latin letters with diacritics
+//	        replaced with ASCII letters and other letters treated as
+//	        punctuation
+//
+// Slugs have no leading or trailing "-", except for the github rule. Slug
+// returns an empty string for unknown rules.
+func Slug(s, rule string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if rule == "ascii" {
+		s = asciiFolds.Replace(s)
+	}
+
+	ret := new(strings.Builder)
+
+	switch rule {
+	case "github":
+		for _, r := range s {
+			switch {
+			case unicode.IsLetter(r) || unicode.IsDigit(r) ||
+				unicode.IsMark(r) || r == '-' || r == '_':
+				ret.WriteRune(r)
+			case r == ' ':
+				ret.WriteByte('-')
+			}
+		}
+
+		return ret.String()
+
+	case "unicode", "ascii":
+		dash := false
+		for _, r := range s {
+			keep := unicode.IsLetter(r) || unicode.IsDigit(r)
+			if rule == "ascii" {
+				keep = r < unicode.MaxASCII && keep
+			}
+
+			if !keep {
+				dash = ret.Len() > 0
+				continue
+			}
+
+			if dash {
+				ret.WriteByte('-')
+				dash = false
+			}
+			ret.WriteRune(r)
+		}
+
+		return ret.String()
+	}
+
+	return ""
+}
+
+// ids generates unique heading IDs with a slug rule, implementing
+// parser.IDs.
+type ids struct {
+	rule   string
+	values map[string]bool
+}
+
+func (s *ids) Generate(value []byte, kind ast.NodeKind) []byte {
+	base := Slug(string(value), s.rule)
+	if base == "" {
+		base = "heading"
+	}
+
+	id := base
+	for i := 1; s.values[id]; i++ {
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+	s.values[id] = true
+
+	return []byte(id)
+}
+
+func (s *ids) Put(value []byte) {
+	s.values[string(value)] = true
+}
@@ -0,0 +1,171 @@
+package markdown
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// Inspect is the default procedure extracting the structure of a Markdown
+// document, see Structure.
+//
+// Like ToHTML, it can be swapped with any other procedure with the same
+// signature, and it should be swapped along with ToHTML, so that both parse
+// documents in the same way.
+var Inspect func([]byte) map[string]any
+
+// Structure returns the structure of a Markdown document, parsed by goldmark
+// from source into doc, as a map with the following keys:
+//
+//	title     the text of the first level 1 heading, empty if none
+//	headings  the tree of headings, as maps with the keys level, text, id
+//	          (empty unless set by the parser) and children
+//	links     links, including autolinks but not the permalink anchors of
+//	          headings, as maps with the keys text, url and title
+//	images    images, as maps with the keys alt, url and title
+//	languages the languages of fenced code blocks, sorted, without repetition
+//
+// The keys are lower case, like those of other variables provided to
+// templates.
+func Structure(doc ast.Node, source []byte) map[string]any {
+	title := ""
+	headings := []any{}
+	links := []any{}
+	images := []any{}
+	languages := map[string]bool{}
+
+	// open holds the headings whose children are still being collected, by
+	// increasing level
+	var open []map[string]any
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Heading:
+			text := plainText(n, source)
+			if n.Level == 1 && title == "" {
+				title = text
+			}
+
+			id := ""
+			if v, ok := n.AttributeString("id"); ok {
+				if b, ok := v.([]byte); ok {
+					id = string(b)
+				}
+			}
+
+			h := map[string]any{
+				"level":    n.Level,
+				"text":     text,
+				"id":       id,
+				"children": []any{},
+			}
+
+			for len(open) > 0 && open[len(open)-1]["level"].(int) >= n.Level {
+				open = open[:len(open)-1]
+			}
+
+			if len(open) == 0 {
+				headings = append(headings, h)
+			} else {
+				parent := open[len(open)-1]
+				parent["children"] = append(parent["children"].([]any), h)
+			}
+			open = append(open, h)
+
+		case *ast.Link:
+			if isAnchor(n) {
+				return ast.WalkSkipChildren, nil
+			}
+
+			links = append(links, map[string]any{
+				"text":  plainText(n, source),
+				"url":   string(n.Destination),
+				"title": string(n.Title),
+			})
+
+		case *ast.AutoLink:
+			links = append(links, map[string]any{
+				"text":  string(n.Label(source)),
+				"url":   string(n.URL(source)),
+				"title": "",
+			})
+
+		case *ast.Image:
+			images = append(images, map[string]any{
+				"alt":   plainText(n, source),
+				"url":   string(n.Destination),
+				"title": string(n.Title),
+			})
+
+		case *ast.FencedCodeBlock:
+			if lang := n.Language(source); len(lang) > 0 {
+				languages[string(lang)] = true
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	langs := []string{}
+	for l := range languages {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+
+	return map[string]any{
+		"title":     title,
+		"headings":  headings,
+		"links":     links,
+		"images":    images,
+		"languages": langs,
+	}
+}
+
+// plainText returns the text of the inline content of n, without markup.
+func plainText(n ast.Node, source []byte) string {
+	buf := new(bytes.Buffer)
+
+	_ = ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Text:
+			buf.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(n.Value)
+		case *ast.AutoLink:
+			buf.Write(n.Label(source))
+		case *ast.Link:
+			if isAnchor(n) {
+				return ast.WalkSkipChildren, nil
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return string(bytes.TrimSpace(buf.Bytes()))
+}
+
+// isAnchor tells whether n is the permalink anchor of a heading, see
+// Config.Anchor.
+func isAnchor(n *ast.Link) bool {
+	class, ok := n.AttributeString("class")
+	if !ok {
+		return false
+	}
+
+	b, ok := class.([]byte)
+
+	return ok && string(b) == "anchor"
+}
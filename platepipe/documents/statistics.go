@@ -0,0 +1,164 @@
+package documents
+
+import (
+	"math"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"cdop.pt/go/free/platepipe/documents/markdown"
+)
+
+// WordsPerMinute is the reading speed used to estimate the reading time of
+// documents, see Measure. Each Chinese or Japanese character counts as a
+// word.
+var WordsPerMinute = 200
+
+// SlugRule is the rule used to generate the slugs of documents, see
+// markdown.Slug and Measure.
+var SlugRule = "ascii"
+
+var headingRegexp = regexp.MustCompile(`(?i)<h[1-6][\s>]`)
+
+// Measure returns statistics of a document, loaded from file, given its
+// content, HTML if isHTML is set, and its title, as a map with the following
+// keys:
+//
+//	wordCount      the number of words, separated by white space or
+//	               punctuation, other than punctuation within words, e.g.,
+//	               in "don't" or "3.14", counting each Chinese or Japanese
+//	               character as a word, as these are not separated by spaces
+//	characterCount the number of characters, excluding white space
+//	headingCount   the number of HTML headings
+//	readingTime    the estimated reading time in minutes, rounded up, see
+//	               WordsPerMinute
+//	slug           a slug generated from the title, or the file name without
+//	               its extension, if the title is empty, see SlugRule
+//	script         the script most letters are written in, e.g., "latin",
+//	               "cyrillic", "greek", "arabic", "hebrew", "cjk" or
+//	               "other", empty if there are no letters
+//
+// The title of a Markdown document may be taken from Describe.
+func Measure(
+	file string, content []byte, isHTML bool, title string,
+) map[string]any {
+	text := string(content)
+	headings := 0
+
+	if isHTML {
+		text = PlainText(content)
+		headings = len(headingRegexp.FindAllIndex(content, -1))
+	}
+
+	words, characters := 0, 0
+	counts := map[string]int{}
+	inWord := false
+
+	runes := []rune(text)
+
+	for i, r := range runes {
+		if unicode.IsSpace(r) {
+			inWord = false
+			continue
+		}
+		characters++
+
+		script := scriptOf(r)
+		if script != "" {
+			counts[script]++
+		}
+
+		switch {
+		case unicode.IsPunct(r):
+			inWord = inWord && i+1 < len(runes) && isWordRune(runes[i+1])
+		case isIdeograph(r):
+			words++
+			inWord = false
+		case !inWord:
+			words++
+			inWord = true
+		}
+	}
+
+	slug := markdown.Slug(title, SlugRule)
+	if slug == "" && file != "" {
+		base := filepath.Base(file)
+		slug = markdown.Slug(strings.TrimSuffix(base, filepath.Ext(base)),
+			SlugRule)
+	}
+
+	minutes := 0
+	if WordsPerMinute > 0 {
+		minutes = int(math.Ceil(float64(words) / float64(WordsPerMinute)))
+	}
+
+	return map[string]any{
+		"wordCount":      words,
+		"characterCount": characters,
+		"headingCount":   headings,
+		"readingTime":    minutes,
+		"slug":           slug,
+		"script":         dominantScript(counts),
+	}
+}
+
+// isIdeograph tells whether r is a Chinese or Japanese character, counted as
+// a word by Measure.
+func isIdeograph(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// isWordRune tells whether r is a letter or digit that may continue a word,
+// i.e., not an ideograph, see isIdeograph.
+func isWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !isIdeograph(r)
+}
+
+// scripts are the scripts recognized by Measure, in the order in which they
+// are preferred when equally frequent.
+var scripts = []struct {
+	name   string
+	tables []*unicode.RangeTable
+}{
+	{"latin", []*unicode.RangeTable{unicode.Latin}},
+	{"cjk", []*unicode.RangeTable{
+		unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul,
+	}},
+	{"cyrillic", []*unicode.RangeTable{unicode.Cyrillic}},
+	{"greek", []*unicode.RangeTable{unicode.Greek}},
+	{"arabic", []*unicode.RangeTable{unicode.Arabic}},
+	{"hebrew", []*unicode.RangeTable{unicode.Hebrew}},
+}
+
+// scriptOf returns the script of the letter r, "other" for letters of
+// scripts not in scripts and an empty string for anything else.
+func scriptOf(r rune) string {
+	if !unicode.IsLetter(r) {
+		return ""
+	}
+
+	for _, s := range scripts {
+		if unicode.IsOneOf(s.tables, r) {
+			return s.name
+		}
+	}
+
+	return "other"
+}
+
+func dominantScript(counts map[string]int) string {
+	ret, most := "", 0
+
+	for _, s := range scripts {
+		if counts[s.name] > most {
+			ret, most = s.name, counts[s.name]
+		}
+	}
+
+	if counts["other"] > most {
+		ret = "other"
+	}
+
+	return ret
+}
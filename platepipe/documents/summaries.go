@@ -0,0 +1,194 @@
+package documents
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	htemplate "html/template"
+)
+
+// SummaryMarker separates the summary of a document from the rest of its
+// content, see Summarize. It is removed from the content.
+var SummaryMarker = "<!--more-->"
+
+// SummaryWords is the maximum number of words of the summaries of documents
+// without SummaryMarker, see Summarize. If zero, summaries are the first
+// paragraph of documents.
+var SummaryWords = 70
+
+// CutSummary cuts buf, the content of a document before any conversion,
+// around the first SummaryMarker, returning the content before the marker and
+// the content without the marker. If there is no marker, it returns nil and
+// buf.
+func CutSummary(buf []byte) ([]byte, []byte) {
+	if SummaryMarker == "" {
+		return nil, buf
+	}
+
+	before, after, found := bytes.Cut(buf, []byte(SummaryMarker))
+	if !found {
+		return nil, buf
+	}
+
+	content := make([]byte, 0, len(before)+len(after))
+	content = append(append(content, before...), after...)
+
+	return before, content
+}
+
+// Summarize returns the summary of a document, given its HTML content and
+// the HTML content before its SummaryMarker, if any, see CutSummary, as a map
+// with the following keys:
+//
+//	html      the summary, as template.HTML
+//	text      the summary as plain text, see PlainText
+//	truncated whether the summary is shorter than the content
+//
+// The summary of documents without a summary, i.e., with a nil summary, is
+// the longest run of whole paragraphs, or sentences of the first paragraph,
+// with no more than SummaryWords words, or the first paragraph if
+// SummaryWords is zero. HTML elements cut short are closed, and sentences cut
+// short, if there is no other choice, are followed by an ellipsis.
+func Summarize(content, summary []byte) map[string]any {
+	if summary == nil {
+		summary = excerpt(content)
+	}
+
+	truncated := len(bytes.TrimSpace(summary)) < len(bytes.TrimSpace(content))
+
+	return map[string]any{
+		"html":      htemplate.HTML(summary),
+		"text":      PlainText(summary),
+		"truncated": truncated,
+	}
+}
+
+var tagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// PlainText returns the text of HTML content, without tags, with entities
+// unescaped and surrounding space removed.
+func PlainText(buf []byte) string {
+	return strings.TrimSpace(
+		html.UnescapeString(tagRegexp.ReplaceAllString(string(buf), "")))
+}
+
+// voidElements are the HTML elements without closing tags.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// boundary is a position in HTML content where a summary may end, along with
+// the elements open there, which need to be closed.
+type boundary struct {
+	pos  int
+	open []string
+}
+
+// excerpt returns the beginning of the HTML content buf, with SummaryWords
+// words at most, cut on a paragraph or sentence boundary, or its first
+// paragraph if SummaryWords is zero.
+func excerpt(buf []byte) []byte {
+	var open []string
+	var last *boundary // the last boundary within SummaryWords words
+
+	words, inWord := 0, false
+	start := 0 // of the last top-level element
+
+	for i := 0; i < len(buf); {
+		if buf[i] == '<' {
+			end := bytes.IndexByte(buf[i:], '>')
+			if end < 0 {
+				break
+			}
+			tag := string(buf[i+1 : i+end])
+			name := tagName(tag)
+
+			if len(open) == 0 {
+				start = i
+			}
+			i += end + 1
+
+			switch {
+			case name == "", voidElements[name], strings.HasSuffix(tag, "/"):
+			case strings.HasPrefix(tag, "/"):
+				if len(open) > 0 {
+					open = open[:len(open)-1]
+				}
+
+				if len(open) == 0 {
+					if SummaryWords == 0 && name == "p" {
+						return buf[start:i]
+					}
+					last = &boundary{i, nil}
+				}
+			default:
+				open = append(open, name)
+			}
+
+			continue
+		}
+
+		c := buf[i]
+		space := isSpace(c)
+
+		if !space && !inWord && SummaryWords > 0 {
+			words++
+
+			if words > SummaryWords {
+				if last == nil {
+					cut := bytes.TrimRightFunc(buf[:i], unicode.IsSpace)
+					return closeElements(
+						append(append([]byte{}, cut...), "…"...), open)
+				}
+
+				return closeElements(append([]byte{}, buf[:last.pos]...),
+					last.open)
+			}
+		}
+		inWord = !space
+		i++
+
+		if strings.IndexByte(".!?", c) >= 0 && len(open) > 0 &&
+			(i == len(buf) || isSpace(buf[i]) || buf[i] == '<') {
+			last = &boundary{i, append([]string{}, open...)}
+		}
+	}
+
+	return buf
+}
+
+// tagName returns the lower case name of the element of an HTML tag, given
+// the content of the tag, e.g., "a" for "/a" and "a href=...", or an empty
+// string for comments and declarations.
+func tagName(tag string) string {
+	if strings.HasPrefix(tag, "!") || strings.HasPrefix(tag, "?") {
+		return ""
+	}
+
+	fields := strings.FieldsFunc(tag, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '/'
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(fields[0])
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\r'
+}
+
+// closeElements appends the closing tags of the given open elements to buf.
+func closeElements(buf []byte, open []string) []byte {
+	for i := len(open) - 1; i >= 0; i-- {
+		buf = append(buf, "</"+open[i]+">"...)
+	}
+
+	return buf
+}
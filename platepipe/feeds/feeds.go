@@ -0,0 +1,306 @@
+// Package feeds writes Atom 1.0 and RSS 2.0 feeds of the documents of
+// collections, see the collections package.
+//
+// Feeds are declared in metadata headers, under the "feeds" key, by name, with
+// a table holding the name of the collection and, optionally, the format,
+// "atom" or "rss", the URL of the feed, its title and description, the
+// author of documents without one, whether to include the content of
+// documents besides their summaries, and the maximum number of entries:
+//
+//	feeds.blog = { collection = "posts", title = "Blog", author = "Ann" }
+//	feeds.rss = { collection = "posts", format = "rss", url = "/rss.xml",
+//	              content = true, limit = 20 }
+//
+// Entries take their fields from the metadata of documents, see Feed.Write,
+// and their URLs, like those of feeds, are made absolute with the base URL of
+// the site, see AbsURL.
+package feeds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	htemplate "html/template"
+
+	"cdop.pt/go/free/platepipe/templates"
+)
+
+// Formats are the known feed formats.
+var Formats = []string{"atom", "rss"}
+
+// Feed is a feed of a collection, as declared in a metadata header.
+type Feed struct {
+	Name        string
+	Collection  string
+	Format      string // "atom" by default
+	URL         string // "/NAME.xml" by default
+	Title       string // Name by default
+	Description string
+	Author      string
+	Content     bool // whether to include the content of documents
+	Limit       int  // the maximum number of entries, 0 for no limit
+}
+
+// Parse reads the feeds declared in metadata, under the "feeds" key, sorted
+// by name, with defaults for the settings not declared.
+func Parse(data map[string]any) ([]Feed, error) {
+	if _, ok := data["feeds"]; !ok {
+		return nil, nil
+	}
+
+	decls, ok := data["feeds"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf(`"feeds" must be a table`)
+	}
+
+	names := []string{}
+	for name := range decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := []Feed{}
+	for _, name := range names {
+		decl, ok := decls[name].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("feed %q must be a table", name)
+		}
+
+		f := Feed{
+			Name:   name,
+			Format: "atom",
+			URL:    "/" + name + ".xml",
+			Title:  name,
+		}
+
+		fields := []struct {
+			key   string
+			value *string
+		}{
+			{"collection", &f.Collection}, {"format", &f.Format},
+			{"url", &f.URL}, {"title", &f.Title},
+			{"description", &f.Description}, {"author", &f.Author},
+		}
+
+		for _, field := range fields {
+			if v, ok := decl[field.key]; ok {
+				if *field.value, ok = v.(string); !ok {
+					return nil, fmt.Errorf(
+						"feed %q must have a string %s", name, field.key)
+				}
+			}
+		}
+
+		if v, ok := decl["content"]; ok {
+			if f.Content, ok = v.(bool); !ok {
+				return nil, fmt.Errorf(
+					"feed %q must have a boolean content", name)
+			}
+		}
+
+		if v, ok := decl["limit"]; ok {
+			limit := reflect.ValueOf(v)
+			if !limit.CanInt() || limit.Int() < 0 {
+				return nil, fmt.Errorf(
+					"feed %q must have a non-negative integer limit", name)
+			}
+			f.Limit = int(limit.Int())
+		}
+
+		if f.Collection == "" {
+			return nil, fmt.Errorf("feed %q has no collection", name)
+		}
+
+		if f.Format != "atom" && f.Format != "rss" {
+			return nil, fmt.Errorf("feed %q has unknown format %q, expected "+
+				"one of: %s", name, f.Format, strings.Join(Formats, ", "))
+		}
+
+		ret = append(ret, f)
+	}
+
+	return ret, nil
+}
+
+// AbsURL returns url, if absolute, or url resolved against base, the URL of
+// the root of the site, e.g., "https://example.com/posts/" for "/posts/".
+func AbsURL(base, url string) string {
+	if strings.Contains(url, "://") {
+		return url
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(url, "/")
+}
+
+// entry is an entry of a feed, with absolute URLs and HTML summaries and
+// content.
+type entry struct {
+	title     string
+	url       string
+	author    string
+	summary   string
+	content   string
+	published time.Time
+	updated   time.Time
+}
+
+// Write writes the feed of docs, the documents of the collection, as loaded
+// by collections.Load, with their content if enabled for the feed, to w, with
+// URLs made absolute with base, see AbsURL.
+//
+// Entries are sorted by publication date, newest first, and take their
+// fields from the following metadata keys of the documents:
+//
+//	title   the title, falling back to the title of the document, e.g., its
+//	        first level 1 heading, see documents.Describe, or its file name
+//	url     the URL, see collections.URL
+//	date    the publication date, falling back to the date of the first
+//	        commit of the file of the document, if known, see files.GitInfo,
+//	        or to its modification time
+//	updated the update date, falling back to the date of the last commit of
+//	        the file, if later, or to the publication date
+//	author  the author, falling back to the author of the feed
+//	summary the summary, see documents.Summarize
+//	content the content, if enabled for the feed
+//
+// The feed is updated when its most recently updated entry is, or at
+// updated, if it has no entries. Dates are written as specified by RFC 3339
+// in Atom feeds and RFC 822, with four digit years, in RSS feeds.
+func (f Feed) Write(
+	w io.Writer, docs []any, base string, updated time.Time,
+) error {
+	entries := []entry{}
+	for _, doc := range docs {
+		e, err := f.entry(doc.(map[string]any), base)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].published.After(entries[j].published)
+	})
+
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[:f.Limit]
+	}
+
+	if len(entries) > 0 {
+		updated = entries[0].updated
+		for _, e := range entries[1:] {
+			if e.updated.After(updated) {
+				updated = e.updated
+			}
+		}
+	}
+
+	var feed any
+	if f.Format == "rss" {
+		feed = f.rss(entries, base, updated)
+	} else {
+		feed = f.atom(entries, base, updated)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+func (f Feed) entry(doc map[string]any, base string) (entry, error) {
+	e := entry{author: f.Author}
+
+	url, _ := doc["url"].(string)
+	e.url = AbsURL(base, url)
+
+	e.title, _ = doc["title"].(string)
+	if e.title == "" {
+		e.title, _ = lookup(doc, "document", "title").(string)
+	}
+	if e.title == "" {
+		e.title, _ = lookup(doc, "file", "name").(string)
+	}
+
+	if author, ok := doc["author"].(string); ok {
+		e.author = author
+	}
+
+	var err error
+
+	first, committed := lookup(doc, "file", "git", "first", "date").(time.Time)
+	last, _ := lookup(doc, "file", "git", "last", "date").(time.Time)
+
+	if v, ok := doc["date"]; ok {
+		e.published, err = templates.ToTime(v)
+	} else if committed {
+		e.published = first
+	} else {
+		e.published, _ = lookup(doc, "file", "modified").(time.Time)
+	}
+	if err != nil {
+		return e, fmt.Errorf("%s: date: %w", url, err)
+	}
+
+	e.updated = e.published
+	if v, ok := doc["updated"]; ok {
+		e.updated, err = templates.ToTime(v)
+	} else if last.After(e.published) {
+		e.updated = last
+	}
+	if err != nil {
+		return e, fmt.Errorf("%s: updated: %w", url, err)
+	}
+
+	e.summary = toHTML(doc["summary"])
+	if f.Content {
+		e.content = toHTML(doc["content"])
+	}
+
+	return e, nil
+}
+
+// lookup returns the value at the given path of keys in nested maps, nil if
+// not found.
+func lookup(v any, keys ...string) any {
+	for _, k := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+
+	return v
+}
+
+// toHTML returns the HTML of a summary, as returned by documents.Summarize,
+// or of HTML or text content, escaped as needed.
+func toHTML(v any) string {
+	switch v := v.(type) {
+	case map[string]any:
+		return toHTML(v["html"])
+	case htemplate.HTML:
+		return string(v)
+	case string:
+		return html.EscapeString(v)
+	}
+
+	return ""
+}
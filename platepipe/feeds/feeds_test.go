@@ -0,0 +1,244 @@
+package feeds_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	htemplate "html/template"
+
+	"cdop.pt/go/free/platepipe/feeds"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestParse(t *testing.T) {
+	fs, err := feeds.Parse(map[string]any{
+		"feeds": map[string]any{
+			"blog": map[string]any{"collection": "posts"},
+			"rss": map[string]any{
+				"collection": "posts", "format": "rss", "url": "/rss.xml",
+				"title": "Blog", "content": true, "limit": int64(5),
+			},
+		},
+	})
+
+	Need(t, err == nil)
+	Need(t, len(fs) == 2)
+	Want(t, fs[0] == feeds.Feed{
+		Name: "blog", Collection: "posts", Format: "atom", URL: "/blog.xml",
+		Title: "blog",
+	})
+	Want(t, fs[1] == feeds.Feed{
+		Name: "rss", Collection: "posts", Format: "rss", URL: "/rss.xml",
+		Title: "Blog", Content: true, Limit: 5,
+	})
+
+	fs, err = feeds.Parse(map[string]any{})
+
+	Want(t, err == nil)
+	Want(t, len(fs) == 0)
+
+	decls := []any{
+		"posts",
+		map[string]any{"blog": "posts"},
+		map[string]any{"blog": map[string]any{}},
+		map[string]any{"blog": map[string]any{
+			"collection": "posts", "format": "json",
+		}},
+		map[string]any{"blog": map[string]any{
+			"collection": "posts", "limit": int64(-1),
+		}},
+		map[string]any{"blog": map[string]any{
+			"collection": "posts", "content": "yes",
+		}},
+	}
+
+	for _, d := range decls {
+		_, err := feeds.Parse(map[string]any{"feeds": d})
+		Want(t, err != nil)
+	}
+}
+
+func TestAbsURL(t *testing.T) {
+	Want(t, feeds.AbsURL("https://example.com", "/a/") ==
+		"https://example.com/a/")
+	Want(t, feeds.AbsURL("https://example.com/", "/a.html") ==
+		"https://example.com/a.html")
+	Want(t, feeds.AbsURL("https://example.com/blog", "a.html") ==
+		"https://example.com/blog/a.html")
+	Want(t, feeds.AbsURL("https://example.com", "http://other.org/") ==
+		"http://other.org/")
+}
+
+var docs = []any{
+	map[string]any{
+		"title":   "Old <post>",
+		"url":     "/posts/old.html",
+		"date":    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"summary": map[string]any{"html": htemplate.HTML("<p>Old &amp; gold</p>")},
+		"content": htemplate.HTML("<p>Old &amp; gold</p><p>More</p>"),
+	},
+	map[string]any{
+		"url":      "/posts/new.html",
+		"date":     "2024-03-04",
+		"updated":  "2024-05-06T07:08:09Z",
+		"author":   "Bob",
+		"summary":  "Plain & simple",
+		"document": map[string]any{"title": "New"},
+	},
+}
+
+func TestAtom(t *testing.T) {
+	f := feeds.Feed{
+		Name: "blog", Collection: "posts", Format: "atom", URL: "/blog.xml",
+		Title: "Blog", Author: "Ann", Content: true,
+	}
+
+	buf := new(bytes.Buffer)
+	err := f.Write(buf, docs, "https://example.com", time.Time{})
+
+	Need(t, err == nil)
+	Want(t, strings.HasPrefix(buf.String(), xml.Header))
+
+	var feed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Updated string   `xml:"updated"`
+		Author  string   `xml:"author>name"`
+		Entries []struct {
+			Title     string `xml:"title"`
+			ID        string `xml:"id"`
+			Published string `xml:"published"`
+			Updated   string `xml:"updated"`
+			Author    string `xml:"author>name"`
+			Summary   string `xml:"summary"`
+			Content   string `xml:"content"`
+		} `xml:"entry"`
+	}
+
+	Need(t, xml.Unmarshal(buf.Bytes(), &feed) == nil)
+	Want(t, feed.ID == "https://example.com/blog.xml")
+	Want(t, feed.Updated == "2024-05-06T07:08:09Z")
+	Want(t, feed.Author == "Ann")
+	Need(t, len(feed.Entries) == 2)
+
+	newer, older := feed.Entries[0], feed.Entries[1]
+	Want(t, newer.Title == "New")
+	Want(t, newer.ID == "https://example.com/posts/new.html")
+	Want(t, newer.Published == "2024-03-04T00:00:00Z")
+	Want(t, newer.Author == "Bob")
+	Want(t, newer.Summary == "Plain &amp; simple")
+	Want(t, older.Title == "Old <post>")
+	Want(t, older.Updated == "2024-01-02T03:04:05Z")
+	Want(t, older.Author == "")
+	Want(t, older.Content == "<p>Old &amp; gold</p><p>More</p>")
+}
+
+func TestRSS(t *testing.T) {
+	f := feeds.Feed{
+		Name: "rss", Collection: "posts", Format: "rss", URL: "/rss.xml",
+		Title: "Blog", Limit: 1,
+	}
+
+	buf := new(bytes.Buffer)
+	err := f.Write(buf, docs, "https://example.com/", time.Time{})
+
+	Need(t, err == nil)
+
+	var feed struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		Channel struct {
+			Description   string `xml:"description"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title       string `xml:"title"`
+				GUID        string `xml:"guid"`
+				PubDate     string `xml:"pubDate"`
+				Creator     string `xml:"creator"`
+				Description string `xml:"description"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+
+	Need(t, xml.Unmarshal(buf.Bytes(), &feed) == nil)
+	Want(t, feed.Version == "2.0")
+	Want(t, strings.Contains(buf.String(),
+		"<link>https://example.com/</link>"))
+	Want(t, feed.Channel.Description == "Blog")
+	Want(t, feed.Channel.LastBuildDate == "Mon, 06 May 2024 07:08:09 +0000")
+	Need(t, len(feed.Channel.Items) == 1)
+
+	item := feed.Channel.Items[0]
+	Want(t, item.Title == "New")
+	Want(t, item.GUID == "https://example.com/posts/new.html")
+	Want(t, item.PubDate == "Mon, 04 Mar 2024 00:00:00 +0000")
+	Want(t, item.Creator == "Bob")
+	Want(t, item.Description == "Plain &amp; simple")
+}
+
+func TestEmptyFeed(t *testing.T) {
+	f := feeds.Feed{Name: "blog", Format: "atom", URL: "/blog.xml"}
+	updated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	buf := new(bytes.Buffer)
+	err := f.Write(buf, []any{}, "https://example.com", updated)
+
+	Need(t, err == nil)
+	Want(t, strings.Contains(buf.String(),
+		"<updated>2024-01-01T00:00:00Z</updated>"))
+}
+
+func TestGitDates(t *testing.T) {
+	first := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	last := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	file := map[string]any{
+		"modified": time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC),
+		"git": map[string]any{
+			"first": map[string]any{"date": first},
+			"last":  map[string]any{"date": last},
+		},
+	}
+
+	f := feeds.Feed{Name: "blog", Format: "atom", URL: "/blog.xml"}
+
+	buf := new(bytes.Buffer)
+	err := f.Write(buf, []any{
+		map[string]any{"url": "/a.html", "file": file},
+		map[string]any{"url": "/b.html", "file": file, "date": "2024-02-01"},
+		map[string]any{"url": "/c.html", "file": file, "date": "2024-04-01"},
+	}, "https://example.com", time.Time{})
+
+	Need(t, err == nil)
+
+	var feed struct {
+		Entries []struct {
+			ID        string `xml:"id"`
+			Published string `xml:"published"`
+			Updated   string `xml:"updated"`
+		} `xml:"entry"`
+	}
+
+	Need(t, xml.Unmarshal(buf.Bytes(), &feed) == nil)
+	Need(t, len(feed.Entries) == 3)
+
+	c, b, a := feed.Entries[0], feed.Entries[1], feed.Entries[2]
+	Want(t, a.Published == "2024-01-02T00:00:00Z")
+	Want(t, a.Updated == "2024-03-04T00:00:00Z")
+	Want(t, b.Published == "2024-02-01T00:00:00Z")
+	Want(t, b.Updated == "2024-03-04T00:00:00Z")
+	Want(t, c.Published == "2024-04-01T00:00:00Z")
+	Want(t, c.Updated == "2024-04-01T00:00:00Z")
+}
+
+func TestBadDates(t *testing.T) {
+	f := feeds.Feed{Name: "blog", Format: "atom", URL: "/blog.xml"}
+
+	err := f.Write(new(bytes.Buffer),
+		[]any{map[string]any{"url": "/a.html", "date": "soon"}},
+		"https://example.com", time.Time{})
+
+	Want(t, err != nil)
+}
@@ -0,0 +1,188 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// The elements of Atom feeds, as specified by RFC 4287.
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Author   *atomPerson `xml:"author,omitempty"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Summary   *atomText   `xml:"summary,omitempty"`
+	Content   *atomText   `xml:"content,omitempty"`
+}
+
+// atom returns the Atom feed of the entries. Since Atom feeds need authors,
+// entries without authors get the title of the feed as their author if the
+// feed has no author.
+func (f Feed) atom(entries []entry, base string, updated time.Time) any {
+	self := AbsURL(base, f.URL)
+
+	ret := &atomFeed{
+		Title:    f.Title,
+		Subtitle: f.Description,
+		ID:       self,
+		Updated:  updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Href: self},
+			{Rel: "alternate", Href: AbsURL(base, "/")},
+		},
+		Entries: []atomEntry{},
+	}
+
+	if f.Author != "" {
+		ret.Author = &atomPerson{f.Author}
+	}
+
+	for _, e := range entries {
+		x := atomEntry{
+			Title:     e.title,
+			ID:        e.url,
+			Link:      atomLink{Rel: "alternate", Href: e.url},
+			Published: e.published.Format(time.RFC3339),
+			Updated:   e.updated.Format(time.RFC3339),
+		}
+
+		switch {
+		case e.author != "" && e.author != f.Author:
+			x.Author = &atomPerson{e.author}
+		case e.author == "" && f.Author == "":
+			x.Author = &atomPerson{f.Title}
+		}
+
+		if e.summary != "" {
+			x.Summary = &atomText{"html", e.summary}
+		}
+		if e.content != "" {
+			x.Content = &atomText{"html", e.content}
+		}
+
+		ret.Entries = append(ret.Entries, x)
+	}
+
+	return ret
+}
+
+// The elements of RSS feeds, as specified by RSS 2.0, with the atom:link
+// element recommended by the RSS Advisory Board, the dc:creator element of
+// the Dublin Core, for authors that are not email addresses, and the
+// content:encoded element of the RSS content module.
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Content string     `xml:"xmlns:content,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          rssSelf   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Body        string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	Description string  `xml:"description,omitempty"`
+	Content     string  `xml:"content:encoded,omitempty"`
+}
+
+// rss returns the RSS feed of the entries. Since RSS channels need
+// descriptions, feeds without one are described by their titles. Items have
+// summaries as descriptions, or the content, if there is no summary, and the
+// content, if included, as encoded content.
+func (f Feed) rss(entries []entry, base string, updated time.Time) any {
+	ret := &rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Content: "http://purl.org/rss/1.0/modules/content/",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          AbsURL(base, "/"),
+			Description:   f.Description,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+			Self: rssSelf{
+				Rel:  "self",
+				Type: "application/rss+xml",
+				Href: AbsURL(base, f.URL),
+			},
+			Items: []rssItem{},
+		},
+	}
+
+	if ret.Channel.Description == "" {
+		ret.Channel.Description = f.Title
+	}
+
+	for _, e := range entries {
+		x := rssItem{
+			Title:       e.title,
+			Link:        e.url,
+			GUID:        rssGUID{true, e.url},
+			PubDate:     e.published.Format(time.RFC1123Z),
+			Creator:     e.author,
+			Description: e.summary,
+			Content:     e.content,
+		}
+
+		if x.Description == "" {
+			x.Description = e.content
+		}
+
+		ret.Channel.Items = append(ret.Channel.Items, x)
+	}
+
+	return ret
+}
@@ -37,7 +37,10 @@ Limitations: at present, only TOML is recognized as metadata.
 */
 package metadata
 
-import "cdop.pt/go/free/platepipe/metadata/toml"
+import (
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/metadata/toml"
+)
 
 // IsPresent heuristically checks if metadata in present in the buffer.
 //
@@ -89,12 +92,18 @@ func isStartOfKey(b byte) bool {
 //	    data, _ := FromTomlBuffer(buf[:pos])
 //	    ProcessContent(buf[pos:])
 //	}
+//
+// Parse errors are returned as *diagnostics.Error values with the line of the
+// error, if the parser reports it, but no file, which is left for the caller
+// to fill in.
 func FromTomlBuffer(buf []byte) (map[string]any, error) {
 	ret := map[string]any{}
 
 	err := toml.Parse(buf, &ret)
 	if err != nil {
-		return map[string]any{}, err
+		e := diagnostics.New(diagnostics.KindMetadata, "", err)
+		e.Line, e.Column = diagnostics.Locate(err.Error(), "line ")
+		return map[string]any{}, e
 	}
 
 	return ret, nil
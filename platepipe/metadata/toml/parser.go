@@ -1,8 +1,12 @@
-// Package toml defines the name, signature and default implementation of the
-// TOML parser procedure.
+// Package toml defines the names, signatures and default implementations of
+// the TOML parser and encoder procedures.
 package toml
 
-import "github.com/BurntSushi/toml"
+import (
+	"io"
+
+	"github.com/BurntSushi/toml"
+)
 
 // Parse is the default parser procedure.
 //
@@ -13,6 +17,16 @@ import "github.com/BurntSushi/toml"
 // main program.
 var Parse func([]byte, any) error
 
+// Encode is the default encoder procedure, which writes the TOML encoding of
+// a value to an io.Writer.
+//
+// Like Parse, it can be swapped with any other encoder procedure with the
+// same signature, as early as possible in the main program.
+var Encode func(io.Writer, any) error
+
 func init() {
 	Parse = toml.Unmarshal
+	Encode = func(w io.Writer, v any) error {
+		return toml.NewEncoder(w).Encode(v)
+	}
 }
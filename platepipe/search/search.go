@@ -0,0 +1,237 @@
+// Package search builds JSON search indexes of documents, so that static
+// sites can be searched without a server.
+//
+// Search indexes are declared in metadata headers, under the "search" key,
+// with a table holding, optionally, the URL of the index, the keys of the
+// fields to include from the headers of documents besides their URL, title and
+// body, the maximum length of bodies, and whether to include an inverted
+// index:
+//
+//	search = { url = "/search.json", fields = ["tags", "date"], body = 300,
+//	           index = true }
+//
+// Documents declaring search = false in their header are left out.
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"cdop.pt/go/free/platepipe/documents"
+)
+
+// Index is a search index, as declared in a metadata header, along with the
+// documents added to it.
+type Index struct {
+	URL      string   // "/search.json" by default
+	Fields   []string // document header keys of the fields of entries
+	Body     int      // maximum length of bodies, in characters, 0 for all
+	Inverted bool     // whether to include an inverted index
+
+	entries []map[string]any
+	terms   map[string]map[int]int // occurrences by document by term
+}
+
+// Parse reads the search index declared in metadata, under the "search" key,
+// with defaults for the settings not declared, or returns nil if there is
+// none.
+func Parse(data map[string]any) (*Index, error) {
+	if _, ok := data["search"]; !ok {
+		return nil, nil
+	}
+
+	decl, ok := data["search"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf(`"search" must be a table`)
+	}
+
+	x := &Index{URL: "/search.json", Fields: []string{}}
+
+	if v, ok := decl["url"]; ok {
+		if x.URL, ok = v.(string); !ok {
+			return nil, fmt.Errorf(`"search" must have a string url`)
+		}
+	}
+
+	if v, ok := decl["fields"]; ok {
+		fields, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf(`"search" must have an array of fields`)
+		}
+
+		for _, f := range fields {
+			f, ok := f.(string)
+			if !ok {
+				return nil, fmt.Errorf(`"search" must have string fields`)
+			}
+			x.Fields = append(x.Fields, f)
+		}
+	}
+
+	if v, ok := decl["body"]; ok {
+		body := reflect.ValueOf(v)
+		if !body.CanInt() || body.Int() < 0 {
+			return nil, fmt.Errorf(
+				`"search" must have a non-negative integer body`)
+		}
+		x.Body = int(body.Int())
+	}
+
+	if v, ok := decl["index"]; ok {
+		if x.Inverted, ok = v.(bool); !ok {
+			return nil, fmt.Errorf(`"search" must have a boolean index`)
+		}
+	}
+
+	return x, nil
+}
+
+// Included reports whether the document with the given metadata belongs in
+// search indexes, which it does unless its "search" key is false.
+func Included(data map[string]any) bool {
+	included, ok := data["search"].(bool)
+	return !ok || included
+}
+
+// Add adds the document with the given URL, header, description, as passed
+// to templates in the "document" variable, and content, HTML if isHTML is
+// set, to the index, as an entry with the following keys, besides the fields
+// of the index defined by the header:
+//
+//	url   the URL of the document
+//	title the title of the document, from its header or its description,
+//	      see documents.Describe
+//	body  the content of the document as plain text, see documents.PlainText,
+//	      cut on a word boundary to the maximum length of bodies, if any
+//
+// The words of the title and of the whole body are added to the inverted
+// index, if enabled.
+func (x *Index) Add(
+	url string, header, info map[string]any, content []byte, isHTML bool,
+) {
+	title, _ := header["title"].(string)
+	if title == "" {
+		title, _ = info["title"].(string)
+	}
+
+	body := strings.TrimSpace(string(content))
+	if isHTML {
+		body = documents.PlainText(content)
+	}
+	body = strings.Join(strings.Fields(body), " ")
+
+	entry := map[string]any{}
+	for _, f := range x.Fields {
+		if v, ok := header[f]; ok {
+			entry[f] = v
+		}
+	}
+
+	entry["url"] = url
+	entry["title"] = title
+	entry["body"] = truncate(body, x.Body)
+
+	if x.Inverted {
+		if x.terms == nil {
+			x.terms = map[string]map[int]int{}
+		}
+
+		for _, term := range Terms(title + " " + body) {
+			if x.terms[term] == nil {
+				x.terms[term] = map[int]int{}
+			}
+			x.terms[term][len(x.entries)]++
+		}
+	}
+
+	x.entries = append(x.entries, entry)
+}
+
+// truncate returns s cut on a word boundary to n characters at most, or s
+// itself if n is zero.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if n == 0 || len(runes) <= n {
+		return s
+	}
+
+	cut := n
+	for cut > 0 && !unicode.IsSpace(runes[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		cut = n
+	}
+
+	return strings.TrimSpace(string(runes[:cut]))
+}
+
+// Terms returns the terms of s, as indexed: lower case runs of letters and
+// digits, with each Chinese or Japanese character as a term of its own, as
+// these are not separated by spaces.
+func Terms(s string) []string {
+	ret := []string{}
+	var term []rune
+
+	flush := func() {
+		if len(term) > 0 {
+			ret = append(ret, string(term))
+			term = term[:0]
+		}
+	}
+
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+			flush()
+			ret = append(ret, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			term = append(term, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return ret
+}
+
+// Write writes the index to w as a JSON object with the entries of the index,
+// in the order in which they were added, under the "documents" key and, if
+// enabled, the inverted index under the "index" key, which maps each term to
+// the documents where it occurs, as pairs of the position of the document in
+// "documents" and the number of occurrences, by position.
+func (x *Index) Write(w io.Writer) error {
+	v := map[string]any{"documents": x.entries}
+	if x.entries == nil {
+		v["documents"] = []any{}
+	}
+
+	if x.Inverted {
+		index := map[string][][2]int{}
+
+		for term, docs := range x.terms {
+			pairs := [][2]int{}
+			for doc, n := range docs {
+				pairs = append(pairs, [2]int{doc, n})
+			}
+			sort.Slice(pairs, func(i, j int) bool {
+				return pairs[i][0] < pairs[j][0]
+			})
+
+			index[term] = pairs
+		}
+
+		v["index"] = index
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	return enc.Encode(v)
+}
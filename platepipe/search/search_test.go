@@ -0,0 +1,126 @@
+package search_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"cdop.pt/go/free/platepipe/search"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestParse(t *testing.T) {
+	x, err := search.Parse(map[string]any{})
+	Need(t, err == nil)
+	Want(t, x == nil)
+
+	x, err = search.Parse(map[string]any{"search": map[string]any{}})
+	Need(t, err == nil && x != nil)
+	Want(t, x.URL == "/search.json")
+	Want(t, len(x.Fields) == 0 && x.Body == 0 && !x.Inverted)
+
+	x, err = search.Parse(map[string]any{"search": map[string]any{
+		"url":    "/index.json",
+		"fields": []any{"tags", "date"},
+		"body":   int64(100),
+		"index":  true,
+	}})
+	Need(t, err == nil && x != nil)
+	Want(t, x.URL == "/index.json")
+	Want(t, strings.Join(x.Fields, ",") == "tags,date")
+	Want(t, x.Body == 100 && x.Inverted)
+
+	bad := []any{
+		true,
+		map[string]any{"url": 1},
+		map[string]any{"fields": "tags"},
+		map[string]any{"fields": []any{1}},
+		map[string]any{"body": -1},
+		map[string]any{"body": "100"},
+		map[string]any{"index": "yes"},
+	}
+	for _, decl := range bad {
+		_, err := search.Parse(map[string]any{"search": decl})
+		Want(t, err != nil)
+	}
+}
+
+func TestIncluded(t *testing.T) {
+	Want(t, search.Included(map[string]any{}))
+	Want(t, search.Included(map[string]any{"search": map[string]any{}}))
+	Want(t, !search.Included(map[string]any{"search": false}))
+}
+
+func TestTerms(t *testing.T) {
+	terms := search.Terms("Hello, World! Go 1.22 日本")
+	Want(t, strings.Join(terms, " ") == "hello world go 1 22 日 本")
+	Want(t, len(search.Terms(" -- ")) == 0)
+}
+
+type result struct {
+	Documents []map[string]any   `json:"documents"`
+	Index     map[string][][]int `json:"index"`
+}
+
+func write(t *testing.T, x *search.Index) result {
+	buf := new(bytes.Buffer)
+	Need(t, x.Write(buf) == nil)
+
+	var r result
+	Need(t, json.Unmarshal(buf.Bytes(), &r) == nil)
+
+	return r
+}
+
+func TestWrite(t *testing.T) {
+	x := &search.Index{Fields: []string{"tags", "missing"}, Body: 12}
+
+	x.Add("/a.html", map[string]any{
+		"title": "A",
+		"tags":  []any{"go"},
+		"draft": true,
+	}, map[string]any{"title": "Heading"},
+		[]byte("<p>Hello <b>big</b> world</p>"), true)
+	x.Add("/b.txt", map[string]any{},
+		map[string]any{"title": "B", "tags": []any{"info"}},
+		[]byte("  plain   <text>\n"), false)
+
+	r := write(t, x)
+
+	Need(t, len(r.Documents) == 2)
+
+	a := r.Documents[0]
+	Want(t, a["url"] == "/a.html" && a["title"] == "A")
+	Want(t, a["body"] == "Hello big")
+	Want(t, a["tags"].([]any)[0] == "go")
+	_, ok := a["missing"]
+	Want(t, !ok)
+	_, ok = a["draft"]
+	Want(t, !ok)
+
+	b := r.Documents[1]
+	Want(t, b["title"] == "B" && b["body"] == "plain <text>")
+	_, ok = b["tags"]
+	Want(t, !ok)
+
+	Want(t, r.Index == nil)
+}
+
+func TestWriteInverted(t *testing.T) {
+	x := &search.Index{Inverted: true}
+
+	x.Add("/a.html", map[string]any{"title": "Go"}, nil, []byte("go go"),
+		false)
+	x.Add("/b.html", map[string]any{"title": "Hi"}, nil, []byte("go"), false)
+
+	r := write(t, x)
+
+	Need(t, len(r.Index["go"]) == 2)
+	Want(t, r.Index["go"][0][0] == 0 && r.Index["go"][0][1] == 3)
+	Want(t, r.Index["go"][1][0] == 1 && r.Index["go"][1][1] == 1)
+	Want(t, len(r.Index["hi"]) == 1 && r.Index["hi"][0][0] == 1)
+
+	r = write(t, &search.Index{Inverted: true})
+	Want(t, len(r.Documents) == 0 && r.Index != nil)
+}
@@ -0,0 +1,161 @@
+// Package sitemaps writes sitemaps, as specified by the sitemaps.org
+// protocol, and robots.txt files pointing to them.
+package sitemaps
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"cdop.pt/go/free/platepipe/templates"
+)
+
+// MaxURLs is the maximum number of URLs per sitemap, see Split.
+var MaxURLs = 50000
+
+// URL is a URL of a sitemap, with the time its page was last modified, if
+// known.
+type URL struct {
+	Loc     string
+	LastMod time.Time
+}
+
+// Included reports whether the page with the given variables belongs in the
+// sitemap, which it does unless its "sitemap" key is false.
+func Included(data map[string]any) bool {
+	included, ok := data["sitemap"].(bool)
+	return !ok || included
+}
+
+// LastMod returns the time the page with the given variables was last
+// modified, taken from its "updated" key, from the date of the last commit of
+// its file, if known, see files.GitInfo, from its "date" key, or from the
+// modification time of its file, under the "file" key, see files.Info, or a
+// zero time if none is known.
+func LastMod(data map[string]any) time.Time {
+	info, _ := data["file"].(map[string]any)
+
+	if v, ok := data["updated"]; ok {
+		if t, err := templates.ToTime(v); err == nil {
+			return t
+		}
+	}
+
+	if git, ok := info["git"].(map[string]any); ok {
+		if last, ok := git["last"].(map[string]any); ok {
+			if t, ok := last["date"].(time.Time); ok {
+				return t
+			}
+		}
+	}
+
+	if v, ok := data["date"]; ok {
+		if t, err := templates.ToTime(v); err == nil {
+			return t
+		}
+	}
+
+	if t, ok := info["modified"].(time.Time); ok {
+		return t
+	}
+
+	return time.Time{}
+}
+
+// Split splits urls into chunks of MaxURLs URLs at most, to be written to
+// separate sitemaps, listed in a sitemap index, see WriteIndex. There is
+// always one chunk, at least.
+func Split(urls []URL) [][]URL {
+	ret := [][]URL{}
+	for len(urls) > MaxURLs {
+		ret = append(ret, urls[:MaxURLs])
+		urls = urls[MaxURLs:]
+	}
+
+	return append(ret, urls)
+}
+
+// Latest returns the latest time any of urls was last modified, or a zero
+// time if none is known, e.g., as the time a sitemap was last modified.
+func Latest(urls []URL) time.Time {
+	ret := time.Time{}
+	for _, u := range urls {
+		if u.LastMod.After(ret) {
+			ret = u.LastMod
+		}
+	}
+
+	return ret
+}
+
+type urlset struct {
+	XMLName xml.Name   `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []location `xml:"url"`
+}
+
+type sitemapindex struct {
+	XMLName  xml.Name   `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []location `xml:"sitemap"`
+}
+
+type location struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func locations(urls []URL) []location {
+	ret := []location{}
+	for _, u := range urls {
+		l := location{Loc: u.Loc}
+		if !u.LastMod.IsZero() {
+			l.LastMod = u.LastMod.Format(time.RFC3339)
+		}
+		ret = append(ret, l)
+	}
+
+	return ret
+}
+
+// Write writes a sitemap of urls, which should be absolute, to w. Sitemaps
+// cannot hold more than MaxURLs URLs.
+func Write(w io.Writer, urls []URL) error {
+	if len(urls) > MaxURLs {
+		return fmt.Errorf("%d URLs exceed the maximum of %d URLs per sitemap",
+			len(urls), MaxURLs)
+	}
+
+	return write(w, &urlset{URLs: locations(urls)})
+}
+
+// WriteIndex writes a sitemap index, listing the sitemaps with the given
+// URLs, which should be absolute, to w.
+func WriteIndex(w io.Writer, sitemaps []URL) error {
+	return write(w, &sitemapindex{Sitemaps: locations(sitemaps)})
+}
+
+func write(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// WriteRobots writes a robots.txt file allowing all crawlers everywhere and
+// pointing to the sitemap at the given absolute URL to w.
+func WriteRobots(w io.Writer, sitemap string) error {
+	_, err := fmt.Fprintf(w, "User-agent: *\nDisallow:\n\nSitemap: %s\n",
+		sitemap)
+
+	return err
+}
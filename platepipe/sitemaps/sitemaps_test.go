@@ -0,0 +1,134 @@
+package sitemaps_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"cdop.pt/go/free/platepipe/sitemaps"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestIncluded(t *testing.T) {
+	Want(t, sitemaps.Included(map[string]any{}))
+	Want(t, sitemaps.Included(map[string]any{"sitemap": true}))
+	Want(t, !sitemaps.Included(map[string]any{"sitemap": false}))
+}
+
+func TestLastMod(t *testing.T) {
+	date := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	updated := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	modified := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	file := map[string]any{"modified": modified}
+
+	Want(t, sitemaps.LastMod(map[string]any{
+		"date": date, "updated": "2024-03-04", "file": file,
+	}).Equal(updated))
+	Want(t, sitemaps.LastMod(map[string]any{
+		"date": "2024-01-02", "file": file,
+	}).Equal(date))
+	Want(t, sitemaps.LastMod(map[string]any{"file": file}).Equal(modified))
+
+	committed := time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC)
+	git := map[string]any{
+		"modified": modified,
+		"git": map[string]any{
+			"last": map[string]any{"date": committed},
+		},
+	}
+	Want(t, sitemaps.LastMod(map[string]any{
+		"date": date, "file": git,
+	}).Equal(committed))
+	Want(t, sitemaps.LastMod(map[string]any{
+		"updated": updated, "file": git,
+	}).Equal(updated))
+	Want(t, sitemaps.LastMod(map[string]any{}).IsZero())
+}
+
+func TestSplit(t *testing.T) {
+	defer func(n int) { sitemaps.MaxURLs = n }(sitemaps.MaxURLs)
+	sitemaps.MaxURLs = 2
+
+	urls := []sitemaps.URL{
+		{Loc: "a"}, {Loc: "b"}, {Loc: "c"}, {Loc: "d"}, {Loc: "e"},
+	}
+
+	chunks := sitemaps.Split(urls)
+
+	Need(t, len(chunks) == 3)
+	Want(t, len(chunks[0]) == 2)
+	Want(t, chunks[2][0].Loc == "e")
+
+	Want(t, len(sitemaps.Split(nil)) == 1)
+	Want(t, sitemaps.Write(new(bytes.Buffer), urls) != nil)
+}
+
+func TestLatest(t *testing.T) {
+	latest := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+
+	Want(t, sitemaps.Latest([]sitemaps.URL{
+		{Loc: "a", LastMod: latest.AddDate(0, -1, 0)},
+		{Loc: "b", LastMod: latest},
+		{Loc: "c"},
+	}).Equal(latest))
+	Want(t, sitemaps.Latest(nil).IsZero())
+}
+
+type location struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+func TestWrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	err := sitemaps.Write(buf, []sitemaps.URL{
+		{Loc: "https://example.com/", LastMod: time.Date(
+			2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{Loc: "https://example.com/a?b&c"},
+	})
+
+	Need(t, err == nil)
+
+	var set struct {
+		XMLName xml.Name   `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []location `xml:"url"`
+	}
+
+	Need(t, xml.Unmarshal(buf.Bytes(), &set) == nil)
+	Need(t, len(set.URLs) == 2)
+	Want(t, set.URLs[0] == location{
+		"https://example.com/", "2024-01-02T03:04:05Z",
+	})
+	Want(t, set.URLs[1] == location{"https://example.com/a?b&c", ""})
+}
+
+func TestWriteIndex(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	err := sitemaps.WriteIndex(buf, []sitemaps.URL{
+		{Loc: "https://example.com/sitemap-1.xml"},
+	})
+
+	Need(t, err == nil)
+
+	var index struct {
+		XMLName  xml.Name   `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+		Sitemaps []location `xml:"sitemap"`
+	}
+
+	Need(t, xml.Unmarshal(buf.Bytes(), &index) == nil)
+	Need(t, len(index.Sitemaps) == 1)
+	Want(t, index.Sitemaps[0].Loc == "https://example.com/sitemap-1.xml")
+}
+
+func TestWriteRobots(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	err := sitemaps.WriteRobots(buf, "https://example.com/sitemap.xml")
+
+	Need(t, err == nil)
+	Want(t, buf.String() == "User-agent: *\nDisallow:\n\n"+
+		"Sitemap: https://example.com/sitemap.xml\n")
+}
@@ -0,0 +1,140 @@
+package templates
+
+import (
+	"bytes"
+
+	"cdop.pt/go/free/platepipe/documents"
+	"cdop.pt/go/free/platepipe/documents/markdown"
+)
+
+// DocumentTemplates makes RenderDocument render the bodies of documents as
+// text/template templates. Documents can override it with the "template" key
+// in their metadata header.
+var DocumentTemplates bool
+
+// RenderDocument renders the body of a document, loaded from file, as a
+// text/template template with data, if enabled by DocumentTemplates or the
+// document's metadata header, and returns it unchanged otherwise. It should
+// be called before any conversion of the body, e.g., from Markdown to HTML.
+//
+// The body is parsed like templates are, with the function library (see
+// Funcs) and partials, and the strict mode setting of the document's header
+// or Strict. Errors refer to lines of file, offset by the line lines taken by
+// its metadata header, see documents.Read.
+func RenderDocument(
+	file string, body []byte, line int, header, data map[string]any,
+) ([]byte, error) {
+	enabled := DocumentTemplates
+	if v, ok := header["template"].(bool); ok {
+		enabled = v
+	}
+
+	if !enabled {
+		return body, nil
+	}
+
+	src := source{file, file, line}
+	if file == "" {
+		src.name = hash(body)
+	}
+
+	t := &Template{source: src, deps: map[string]bool{}}
+
+	err := newTextTemplate(t, []part{{src, body, header}})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = t.Apply(buf, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Document is a document to render with RenderContent, as read by
+// documents.Read.
+type Document struct {
+	File     string // empty for standard input
+	Body     []byte
+	Header   map[string]any // the metadata header
+	Line     int            // lines taken by the metadata header
+	Markdown bool           // whether to convert the body to HTML
+	HTMLSafe bool
+	Conv     *markdown.Converter // nil for the default configuration
+}
+
+// Content is a document rendered by RenderContent.
+type Content struct {
+	Body     []byte
+	Document map[string]any // the statistics and structure of the document
+	Summary  map[string]any // nil unless summarized
+}
+
+// RenderContent renders a document with data, as made available to its
+// shortcodes and its body template: it expands its shortcodes, see
+// ExpandShortcodes, renders its body, see RenderDocument, converts it from
+// Markdown to HTML, if needed, and restores its shortcodes. The statistics of
+// the document, along with the structure of Markdown documents, are returned
+// in Content.Document, see documents.Measure and documents.Describe, and the
+// summary of HTML and Markdown documents whose header does not define one in
+// Content.Summary, see documents.Summarize.
+func RenderContent(doc *Document, data map[string]any) (*Content, error) {
+	body, shortcodes, err := ExpandShortcodes(doc.File, doc.Body, doc.Line,
+		data)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err = RenderDocument(doc.File, body, doc.Line, doc.Header, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary []byte
+
+	_, defined := doc.Header["summary"]
+	summarize := doc.HTMLSafe && !defined
+	if summarize {
+		summary, body = documents.CutSummary(body)
+	}
+
+	ret := &Content{Document: map[string]any{}}
+
+	if doc.Markdown {
+		ret.Document = documents.Describe(doc.Conv, body, doc.Header)
+
+		body, err = documents.MarkdownToHTML(doc.Conv, doc.File, body)
+		if err != nil {
+			return nil, err
+		}
+
+		if summary != nil {
+			summary, err = documents.MarkdownToHTML(doc.Conv, doc.File, summary)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ret.Body = shortcodes.Restore(body)
+
+	title, _ := ret.Document["title"].(string)
+	if title == "" {
+		title, _ = doc.Header["title"].(string)
+	}
+
+	stats := documents.Measure(doc.File, ret.Body, doc.HTMLSafe, title)
+	for k, v := range stats {
+		ret.Document[k] = v
+	}
+
+	if summarize {
+		ret.Summary = documents.Summarize(ret.Body, shortcodes.Restore(summary))
+	}
+
+	return ret, nil
+}
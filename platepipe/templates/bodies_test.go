@@ -0,0 +1,151 @@
+package templates_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/templates"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestRenderDocument(t *testing.T) {
+	body := []byte("Version {{ .release | upper }}\n")
+	data := map[string]any{"release": "v1.2"}
+
+	cases := []struct {
+		name    string
+		enabled bool
+		header  map[string]any
+		ret     string
+	}{
+		{"disabled", false, map[string]any{}, string(body)},
+		{"enabled", true, map[string]any{}, "Version V1.2\n"},
+		{"enabled by header", false, map[string]any{"template": true},
+			"Version V1.2\n"},
+		{"disabled by header", true, map[string]any{"template": false},
+			string(body)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			templates.DocumentTemplates = c.enabled
+			defer func() { templates.DocumentTemplates = false }()
+
+			ret, err := templates.RenderDocument("doc.md", body, 2, c.header, data)
+
+			Need(t, err == nil)
+			Want(t, string(ret) == c.ret)
+		})
+	}
+
+	t.Run("strict header", func(t *testing.T) {
+		header := map[string]any{"template": true, "strict": true}
+
+		_, err := templates.RenderDocument("doc.md", []byte("\n{{ .missing }}"),
+			3, header, map[string]any{})
+
+		var d *diagnostics.Error
+		Need(t, errors.As(err, &d))
+		Want(t, d.Kind == diagnostics.KindTemplateExec)
+		Want(t, d.File == "doc.md")
+		Want(t, d.Line == 5)
+	})
+
+	t.Run("parse error", func(t *testing.T) {
+		header := map[string]any{"template": true}
+
+		_, err := templates.RenderDocument("", []byte("{{ .open"),
+			0, header, map[string]any{})
+
+		var d *diagnostics.Error
+		Need(t, errors.As(err, &d))
+		Want(t, d.Kind == diagnostics.KindTemplateParse)
+		Want(t, d.Line == 1)
+	})
+}
+
+func TestRenderContent(t *testing.T) {
+	render := func(header map[string]any, md string) *templates.Content {
+		content, err := templates.RenderContent(&templates.Document{
+			File:     "doc.md",
+			Body:     []byte(md),
+			Header:   header,
+			Markdown: true,
+			HTMLSafe: true,
+		}, header)
+		Need(t, err == nil)
+
+		return content
+	}
+
+	t.Run("structure", func(t *testing.T) {
+		md := "# Manual\n\nSee [the *site*](https://a.example \"A\") and " +
+			"<https://b.example>.\n\n## Install\n\n![logo](logo.png)\n\n" +
+			"### From source\n\n```go\ncode\n```\n\n```sh\n```\n\n" +
+			"## Use\n\n```go\n```\n"
+
+		content := render(map[string]any{}, md)
+
+		Want(t, fmt.Sprint(content.Document) == fmt.Sprint(map[string]any{
+			"title": "Manual",
+			"headings": []any{
+				map[string]any{"level": 1, "text": "Manual", "id": "",
+					"children": []any{
+						map[string]any{"level": 2, "text": "Install", "id": "",
+							"children": []any{
+								map[string]any{"level": 3,
+									"text": "From source", "id": "",
+									"children": []any{}},
+							}},
+						map[string]any{"level": 2, "text": "Use", "id": "",
+							"children": []any{}},
+					}},
+			},
+			"links": []any{
+				map[string]any{"text": "the site", "url": "https://a.example",
+					"title": "A"},
+				map[string]any{"text": "https://b.example",
+					"url": "https://b.example", "title": ""},
+			},
+			"images": []any{
+				map[string]any{"alt": "logo", "url": "logo.png", "title": ""},
+			},
+			"languages":      []string{"go", "sh"},
+			"wordCount":      12,
+			"characterCount": 61,
+			"headingCount":   4,
+			"readingTime":    1,
+			"slug":           "manual",
+			"script":         "latin",
+		}))
+
+		content = render(map[string]any{"title": "T"}, "# Manual\n")
+
+		Want(t, content.Document["title"] == "T")
+	})
+
+	t.Run("summary marker", func(t *testing.T) {
+		md := "# Title\n\nIntro *text*.\n\n<!--more-->\n\nRest.\n"
+
+		content := render(map[string]any{}, md)
+
+		Want(t, string(content.Body) ==
+			"<h1>Title</h1>\n<p>Intro <em>text</em>.</p>\n<p>Rest.</p>\n")
+		Want(t, fmt.Sprint(content.Summary) == fmt.Sprint(map[string]any{
+			"html":      "<h1>Title</h1>\n<p>Intro <em>text</em>.</p>\n",
+			"text":      "Title\nIntro text.",
+			"truncated": true,
+		}))
+	})
+
+	t.Run("summary in header", func(t *testing.T) {
+		content := render(map[string]any{"summary": "Mine"},
+			"Text.\n<!--more-->\n")
+
+		Want(t, content.Summary == nil)
+		Want(t, string(content.Body) ==
+			"<p>Text.</p>\n<!-- raw HTML omitted -->\n")
+	})
+}
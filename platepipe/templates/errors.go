@@ -0,0 +1,100 @@
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+)
+
+// sourceError is a template error whose message was rewritten to refer to
+// lines in the template's source file.
+type sourceError struct {
+	msg string
+	err error
+}
+
+func (e *sourceError) Error() string {
+	return e.msg
+}
+
+func (e *sourceError) Unwrap() error {
+	return e.err
+}
+
+// source identifies where a template came from.
+type source struct {
+	file string // empty if not read from a file
+	name string // name used in error messages, the file path if known
+	line int    // lines preceding the template body, i.e., metadata header
+}
+
+// shift shifts the line numbers reported for the template in msg by the
+// number of lines taken by the metadata header that was stripped before
+// parsing. Both packages report positions as "name:line" or
+// "name:line:column", in parse errors, execution errors and html/template
+// escaping errors alike.
+func (src source) shift(msg string) string {
+	if src.line == 0 {
+		return msg
+	}
+
+	return src.position().ReplaceAllStringFunc(msg, func(m string) string {
+		prefix, n, _ := strings.Cut(m, src.name+":")
+		line, _ := strconv.Atoi(n)
+		return fmt.Sprintf("%s%s:%d", prefix, src.name, line+src.line)
+	})
+}
+
+// position returns a regular expression matching the positions reported for
+// the template, "name:line", where name is not part of a longer path, e.g.,
+// "base.html:3" but not "mybase.html:3".
+func (src source) position() *regexp.Regexp {
+	return regexp.MustCompile(`(?:^|[^\w./\\-])` +
+		regexp.QuoteMeta(src.name) + `:\d+`)
+}
+
+// error converts an error returned by the standard library template packages
+// into a diagnostics.Error of the given kind, with line numbers referring to
+// the source files of the template and its layouts, and located in the file
+// whose position comes first in the error message.
+func (t *Template) error(kind diagnostics.Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	srcs := append([]source{t.source}, t.layouts...)
+
+	msg := layoutPartialRE.ReplaceAllString(err.Error(), "partial")
+	for _, src := range srcs {
+		msg = src.shift(msg)
+	}
+
+	located, first := t.source, -1
+	for _, src := range srcs {
+		loc := src.position().FindStringIndex(msg)
+		if loc != nil && (first < 0 || loc[0] < first) {
+			located, first = src, loc[0]
+		}
+	}
+
+	e := diagnostics.New(kind, located.file, &sourceError{msg, err})
+	e.Line, e.Column = diagnostics.Locate(msg[max(first, 0):],
+		located.name+":")
+
+	return e
+}
+
+// sourceNamed returns the source of the template or layout with the given
+// name.
+func (t *Template) sourceNamed(name string) source {
+	for _, src := range t.layouts {
+		if src.name == name {
+			return src
+		}
+	}
+
+	return t.source
+}
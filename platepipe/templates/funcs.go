@@ -0,0 +1,696 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	htemplate "html/template"
+
+	"cdop.pt/go/free/platepipe/documents/markdown"
+	"cdop.pt/go/free/platepipe/metadata/toml"
+)
+
+// Funcs holds the functions available to both text and HTML templates, in
+// addition to the builtin functions of the Go template packages.
+//
+// Library users can add their own functions, or replace the ones below, by
+// changing this map before loading templates.
+//
+// Functions taking a string or list to operate on take it as their last
+// argument, so that they can be used at the end of pipelines, e.g.,
+// {{ .title | replace " " "-" | lower }}.
+//
+// Strings:
+//
+//	lower s, upper s, title s
+//	trim s, trimPrefix prefix s, trimSuffix suffix s
+//	replace old new s, split sep s, join sep list
+//	contains substr s, hasPrefix prefix s, hasSuffix suffix s
+//
+// Dictionaries and lists:
+//
+//	dict key value [key value]..., list [value]...
+//	keys dict (sorted), append list value, first list, last list
+//
+// Sorting, filtering and grouping of lists, where items may be maps and key
+// a dot-separated path into them, e.g., "author.name":
+//
+//	sort list, reverse list, sortBy key list
+//	where key value list (items whose key equals or contains value)
+//	groupBy key list (list of "key" and "items" maps, sorted by key)
+//
+// Math, on integers and floats:
+//
+//	add a b, sub a b, mul a b, div a b, mod a b
+//	min a [b]..., max a [b]..., floor x, ceil x, round x
+//
+// Defaults:
+//
+//	default value v (value if v is empty), coalesce [v]..., empty v
+//
+// Dates, given as time.Time values or as strings in RFC 3339 format or a
+// prefix of it (e.g., "2024-03-02"):
+//
+//	now, dateFormat layout date (Go reference time layout)
+//
+// Encoding:
+//
+//	toJSON v, toTOML v
+//
+// Content conversion, using the Markdown conversion procedure of the markdown
+// package:
+//
+//	markdownify s (Markdown to HTML)
+//	markdownifyInline s (same, without the paragraph around single paragraphs)
+//	plainify s (HTML to plain text, i.e., without tags or entities)
+//
+// In HTML templates, markdownify and markdownifyInline return template.HTML
+// values, which are not escaped. These two cannot be replaced in this map for
+// HTML templates.
+var Funcs = map[string]any{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"title":      title,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": trimPrefix,
+	"trimSuffix": trimSuffix,
+	"replace":    replace,
+	"split":      split,
+	"join":       join,
+	"contains":   contains,
+	"hasPrefix":  hasPrefix,
+	"hasSuffix":  hasSuffix,
+
+	"dict":   dict,
+	"list":   func(vs ...any) []any { return vs },
+	"keys":   keys,
+	"append": appendList,
+	"first":  first,
+	"last":   last,
+
+	"sort":    sortList,
+	"reverse": reverse,
+	"sortBy":  sortBy,
+	"where":   where,
+	"groupBy": groupBy,
+
+	"add":   add,
+	"sub":   sub,
+	"mul":   mul,
+	"div":   div,
+	"mod":   mod,
+	"min":   func(x any, xs ...any) (any, error) { return extreme(-1, x, xs) },
+	"max":   func(x any, xs ...any) (any, error) { return extreme(1, x, xs) },
+	"floor": func(x any) (float64, error) { return round(math.Floor, x) },
+	"ceil":  func(x any) (float64, error) { return round(math.Ceil, x) },
+	"round": func(x any) (float64, error) { return round(math.Round, x) },
+
+	"default":  func(value, v any) any { return coalesce(v, value) },
+	"coalesce": coalesce,
+	"empty":    empty,
+
+	"now":        func() time.Time { return Now() },
+	"dateFormat": dateFormat,
+
+	"toJSON": toJSON,
+	"toTOML": toTOML,
+
+	"markdownify":       markdownify,
+	"markdownifyInline": markdownifyInline,
+	"plainify":          plainify,
+}
+
+// htmlFuncs override Funcs in HTML templates.
+var htmlFuncs = map[string]any{
+	"markdownify": func(s any) (htemplate.HTML, error) {
+		ret, err := markdownify(s)
+		return htemplate.HTML(ret), err
+	},
+	"markdownifyInline": func(s any) (htemplate.HTML, error) {
+		ret, err := markdownifyInline(s)
+		return htemplate.HTML(ret), err
+	},
+}
+
+// Now is the clock procedure used by the now template function.
+//
+// It can be swapped with any other procedure with the same signature, e.g.,
+// for reproducible output, as early as possible in the main program.
+var Now = time.Now
+
+func title(s string) string {
+	prev := ' '
+
+	return strings.Map(func(r rune) rune {
+		start := unicode.IsSpace(prev) || prev == '-'
+		prev = r
+
+		if start {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
+
+func trimPrefix(prefix, s string) string {
+	return strings.TrimPrefix(s, prefix)
+}
+
+func trimSuffix(suffix, s string) string {
+	return strings.TrimSuffix(s, suffix)
+}
+
+func replace(old, new, s string) string {
+	return strings.ReplaceAll(s, old, new)
+}
+
+func split(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+func contains(substr, s string) bool {
+	return strings.Contains(s, substr)
+}
+
+func hasPrefix(prefix, s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+func hasSuffix(suffix, s string) bool {
+	return strings.HasSuffix(s, suffix)
+}
+
+func join(sep string, list any) (string, error) {
+	items, err := toList(list)
+	if err != nil {
+		return "", err
+	}
+
+	strs := make([]string, len(items))
+	for i, v := range items {
+		strs[i] = fmt.Sprint(v)
+	}
+
+	return strings.Join(strs, sep), nil
+}
+
+func dict(kvs ...any) (map[string]any, error) {
+	if len(kvs)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments")
+	}
+
+	ret := map[string]any{}
+	for i := 0; i < len(kvs); i += 2 {
+		k, ok := kvs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is not a string", kvs[i])
+		}
+		ret[k] = kvs[i+1]
+	}
+
+	return ret, nil
+}
+
+func keys(m any) ([]string, error) {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map {
+		return nil, fmt.Errorf("keys: %T is not a map", m)
+	}
+
+	ret := []string{}
+	for _, k := range v.MapKeys() {
+		ret = append(ret, fmt.Sprint(k.Interface()))
+	}
+	sort.Strings(ret)
+
+	return ret, nil
+}
+
+func appendList(list any, v any) ([]any, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]any{}, items...), v), nil
+}
+
+func first(list any) (any, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+
+	return items[0], nil
+}
+
+func last(list any) (any, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+
+	return items[len(items)-1], nil
+}
+
+// toList converts any slice or array to []any, nil to an empty list.
+func toList(list any) ([]any, error) {
+	if list == nil {
+		return []any{}, nil
+	}
+
+	if items, ok := list.([]any); ok {
+		return items, nil
+	}
+
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%T is not a list", list)
+	}
+
+	ret := make([]any, v.Len())
+	for i := range ret {
+		ret[i] = v.Index(i).Interface()
+	}
+
+	return ret, nil
+}
+
+// lookup returns the value at a dot-separated path of map keys in v, nil if
+// not found.
+func lookup(v any, path string) any {
+	for _, k := range strings.Split(path, ".") {
+		m := reflect.ValueOf(v)
+		if m.Kind() != reflect.Map || m.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+
+		e := m.MapIndex(reflect.ValueOf(k).Convert(m.Type().Key()))
+		if !e.IsValid() {
+			return nil
+		}
+		v = e.Interface()
+	}
+
+	return v
+}
+
+// Compare returns -1, 0 or +1, depending on whether a is less than, equal to
+// or greater than b, in the order used by the sorting functions, e.g., sortBy:
+// numbers, strings, times and booleans are ordered among values of the same
+// kind, nil before anything else, and other values by their default string
+// formatting.
+func Compare(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if x, err := toFloat(a); err == nil {
+		if y, err := toFloat(b); err == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	}
+
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case y:
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func sortList(list any) ([]any, error) {
+	return sortBy("", list)
+}
+
+func reverse(list any) ([]any, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]any, len(items))
+	for i, v := range items {
+		ret[len(items)-1-i] = v
+	}
+
+	return ret, nil
+}
+
+// sortBy sorts a list by the values at key, or by the items themselves when
+// key is empty. The sort is stable.
+func sortBy(key string, list any) ([]any, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func(v any) any { return v }
+	if key != "" {
+		value = func(v any) any { return lookup(v, key) }
+	}
+
+	ret := append([]any{}, items...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return Compare(value(ret[i]), value(ret[j])) < 0
+	})
+
+	return ret, nil
+}
+
+func where(key string, value any, list any) ([]any, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []any{}
+	for _, item := range items {
+		for _, v := range values(lookup(item, key)) {
+			if Compare(v, value) == 0 {
+				ret = append(ret, item)
+				break
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// groupBy groups list items by the values at key. Items whose value at key is
+// a list are put in the group of each value in the list, items without a
+// value at key are left out.
+func groupBy(key string, list any) ([]map[string]any, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []map[string]any{}
+	for _, item := range items {
+	values:
+		for _, v := range values(lookup(item, key)) {
+			if v == nil {
+				continue
+			}
+			for _, g := range groups {
+				if Compare(g["key"], v) == 0 {
+					g["items"] = append(g["items"].([]any), item)
+					continue values
+				}
+			}
+			groups = append(groups, map[string]any{
+				"key":   v,
+				"items": []any{item},
+			})
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return Compare(groups[i]["key"], groups[j]["key"]) < 0
+	})
+
+	return groups, nil
+}
+
+// values returns the items of v if v is a list, v itself otherwise.
+func values(v any) []any {
+	if _, isString := v.(string); !isString {
+		if items, err := toList(v); err == nil && v != nil {
+			return items
+		}
+	}
+
+	return []any{v}
+}
+
+func toFloat(v any) (float64, error) {
+	r := reflect.ValueOf(v)
+
+	switch {
+	case isInteger(r) && r.CanInt():
+		return float64(r.Int()), nil
+	case isInteger(r):
+		return float64(r.Uint()), nil
+	case isFloat(r):
+		return r.Float(), nil
+	}
+
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+func toInt(v any) (int64, bool) {
+	r := reflect.ValueOf(v)
+
+	switch {
+	case isInteger(r) && r.CanInt():
+		return r.Int(), true
+	case isInteger(r):
+		return int64(r.Uint()), true
+	}
+
+	return 0, false
+}
+
+// arith applies an arithmetic operation on integers when both operands are
+// integers, on floats otherwise.
+func arith(
+	a, b any, fi func(x, y int64) (int64, error), ff func(x, y float64) float64,
+) (any, error) {
+	if x, ok := toInt(a); ok {
+		if y, ok := toInt(b); ok {
+			return fi(x, y)
+		}
+	}
+
+	x, err := toFloat(a)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := toFloat(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return ff(x, y), nil
+}
+
+func add(a, b any) (any, error) {
+	return arith(a, b,
+		func(x, y int64) (int64, error) { return x + y, nil },
+		func(x, y float64) float64 { return x + y })
+}
+
+func sub(a, b any) (any, error) {
+	return arith(a, b,
+		func(x, y int64) (int64, error) { return x - y, nil },
+		func(x, y float64) float64 { return x - y })
+}
+
+func mul(a, b any) (any, error) {
+	return arith(a, b,
+		func(x, y int64) (int64, error) { return x * y, nil },
+		func(x, y float64) float64 { return x * y })
+}
+
+func div(a, b any) (any, error) {
+	return arith(a, b,
+		func(x, y int64) (int64, error) {
+			if y == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return x / y, nil
+		},
+		func(x, y float64) float64 { return x / y })
+}
+
+func mod(a, b any) (any, error) {
+	return arith(a, b,
+		func(x, y int64) (int64, error) {
+			if y == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return x % y, nil
+		},
+		math.Mod)
+}
+
+// extreme returns the smallest (sign -1) or largest (sign 1) number.
+func extreme(sign int, x any, xs []any) (any, error) {
+	ret := x
+	if _, err := toFloat(ret); err != nil {
+		return nil, err
+	}
+
+	for _, v := range xs {
+		if _, err := toFloat(v); err != nil {
+			return nil, err
+		}
+		if Compare(v, ret)*sign > 0 {
+			ret = v
+		}
+	}
+
+	return ret, nil
+}
+
+func round(f func(float64) float64, x any) (float64, error) {
+	v, err := toFloat(x)
+	if err != nil {
+		return 0, err
+	}
+
+	return f(v), nil
+}
+
+func empty(v any) bool {
+	if v == nil {
+		return true
+	}
+
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return r.Len() == 0
+	}
+
+	return r.IsZero()
+}
+
+func coalesce(vs ...any) any {
+	for _, v := range vs {
+		if !empty(v) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// dateLayouts are the formats accepted for dates given as strings, RFC 3339
+// and its prefixes, as in TOML.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// ToTime returns date as a time, if it is a time or a string in one of the
+// formats accepted by the date functions, e.g., dateFormat, which are RFC 3339
+// and its prefixes, as in TOML.
+func ToTime(date any) (time.Time, error) {
+	switch d := date.(type) {
+	case time.Time:
+		return d, nil
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, d); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid date %q", d)
+	}
+
+	return time.Time{}, fmt.Errorf("%v is not a date", date)
+}
+
+func dateFormat(layout string, date any) (string, error) {
+	t, err := ToTime(date)
+	if err != nil {
+		return "", err
+	}
+
+	return t.Format(layout), nil
+}
+
+func toJSON(v any) (string, error) {
+	buf := new(bytes.Buffer)
+
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	err := enc.Encode(v)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func markdownify(s any) (string, error) {
+	buf := new(bytes.Buffer)
+
+	err := markdown.ToHTML([]byte(fmt.Sprint(s)), buf)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func markdownifyInline(s any) (string, error) {
+	ret, err := markdownify(s)
+	if err != nil {
+		return "", err
+	}
+
+	ret = strings.TrimSpace(ret)
+	if strings.HasPrefix(ret, "<p>") && strings.HasSuffix(ret, "</p>") &&
+		strings.Count(ret, "<p>") == 1 {
+		ret = ret[len("<p>") : len(ret)-len("</p>")]
+	}
+
+	return ret, nil
+}
+
+var tagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+func plainify(s any) string {
+	return html.UnescapeString(tagRegexp.ReplaceAllString(fmt.Sprint(s), ""))
+}
+
+func toTOML(v any) (string, error) {
+	buf := new(bytes.Buffer)
+
+	err := toml.Encode(buf, v)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,131 @@
+package templates_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	htemplate "html/template"
+
+	"cdop.pt/go/free/platepipe/templates"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestFuncs(t *testing.T) {
+	date := time.Date(2024, 3, 2, 10, 30, 0, 0, time.UTC)
+
+	data := map[string]any{
+		"title": "hello big-world",
+		"tags":  []any{"go", "web"},
+		"n":     int64(7),
+		"f":     2.5,
+		"date":  date,
+		"posts": []map[string]any{
+			{"title": "b", "n": 2, "tags": []any{"x"}},
+			{"title": "a", "n": 3, "tags": []any{"x", "y"}},
+			{"title": "c", "n": 1, "author": map[string]any{"name": "z"}},
+		},
+	}
+
+	cases := []struct {
+		tpl string
+		out string
+	}{
+		{`{{ .title | upper }}`, "HELLO BIG-WORLD"},
+		{`{{ .title | title }}`, "Hello Big-World"},
+		{`{{ "  x " | trim }}|`, "x|"},
+		{`{{ .title | replace " " "_" | trimPrefix "hello" }}`, "_big-world"},
+		{`{{ .title | split " " | join "," }}`, "hello,big-world"},
+		{`{{ .tags | join "/" }} {{ contains "big" .title }}`, "go/web true"},
+		{`{{ $d := dict "a" 1 "b" 2 }}{{ keys $d }} {{ $d.b }}`, "[a b] 2"},
+		{`{{ list 1 "x" | last }} {{ append .tags "db" }}`, "x [go web db]"},
+		{`{{ list 3 1 2 | sort }} {{ list 3 1 2 | reverse }}`, "[1 2 3] [2 1 3]"},
+		{`{{ range sortBy "title" .posts }}{{ .title }}{{ end }}`, "abc"},
+		{`{{ range sortBy "n" .posts }}{{ .title }}{{ end }}`, "cba"},
+		{`{{ range sortBy "author.name" .posts }}{{ .title }}{{ end }}`, "bac"},
+		{`{{ range where "tags" "y" .posts }}{{ .title }}{{ end }}`, "a"},
+		{`{{ range where "n" 2 .posts }}{{ .title }}{{ end }}`, "b"},
+		{`{{ range groupBy "tags" .posts }}{{ .key }}:{{ len .items }} {{ end }}`,
+			"x:2 y:1 "},
+		{`{{ add .n 1 }} {{ sub .n 10 }} {{ mul .n .f }} {{ div .n 2 }}`,
+			"8 -3 17.5 3"},
+		{`{{ mod .n 4 }} {{ min 3 .n 1.5 }} {{ max 3 .n }} {{ ceil .f }}`,
+			"3 1.5 7 3"},
+		{`{{ "" | default "d" }} {{ .title | default "d" }}`, "d hello big-world"},
+		{`{{ coalesce "" 0 .tags }} {{ empty .nothing }}`, "[go web] true"},
+		{`{{ dateFormat "2006/01/02" .date }}`, "2024/03/02"},
+		{`{{ dateFormat "Jan 2" "2024-03-02" }}`, "Mar 2"},
+		{`{{ dict "b" "<1>" "a" .tags | toJSON }}`, `{"a":["go","web"],"b":"<1>"}`},
+		{`{{ dict "k" "v" | toTOML }}`, "k = \"v\"\n"},
+	}
+
+	for _, c := range cases {
+		tpl, _, err := templates.TextTemplateFromStream(
+			bytes.NewBufferString(c.tpl))
+		Need(t, err == nil)
+
+		buf := new(bytes.Buffer)
+		err = tpl.Apply(buf, data)
+
+		if err != nil || buf.String() != c.out {
+			t.Errorf("%s rendered %q, %v", c.tpl, buf.String(), err)
+		}
+	}
+}
+
+func TestContentFuncs(t *testing.T) {
+	data := map[string]any{
+		"bio":   "I *like* [Go](https://go.dev) & C",
+		"html":  htemplate.HTML("<p>a &amp; <b>b</b></p>"),
+		"multi": "one\n\ntwo",
+	}
+
+	cases := []struct {
+		tpl  string
+		html bool
+		out  string
+	}{
+		{`{{ markdownify .bio }}`, false,
+			"<p>I <em>like</em> <a href=\"https://go.dev\">Go</a> &amp; C</p>\n"},
+		{`<div>{{ markdownify .bio }}</div>`, true,
+			"<div><p>I <em>like</em> <a href=\"https://go.dev\">Go</a> &amp; C</p>\n</div>"},
+		{`<span>{{ markdownifyInline .bio }}</span>`, true,
+			"<span>I <em>like</em> <a href=\"https://go.dev\">Go</a> &amp; C</span>"},
+		{`{{ markdownifyInline .multi }}`, false, "<p>one</p>\n<p>two</p>"},
+		{`{{ plainify .html }}`, false, "a & b"},
+		{`<p title="{{ .bio | markdownify | plainify }}"></p>`, true,
+			"<p title=\"I like Go &amp; C\n\"></p>"},
+	}
+
+	for _, c := range cases {
+		load := templates.TextTemplateFromStream
+		if c.html {
+			load = templates.HTMLTemplateFromStream
+		}
+
+		tpl, _, err := load(bytes.NewBufferString(c.tpl))
+		Need(t, err == nil)
+
+		buf := new(bytes.Buffer)
+		err = tpl.Apply(buf, data)
+
+		if err != nil || buf.String() != c.out {
+			t.Errorf("%s rendered %q, %v", c.tpl, buf.String(), err)
+		}
+	}
+}
+
+func TestCustomFuncs(t *testing.T) {
+	templates.Funcs["shout"] = func(s string) string { return s + "!" }
+	defer delete(templates.Funcs, "shout")
+
+	tpl, _, err := templates.HTMLTemplateFromStream(
+		bytes.NewBufferString(`<p>{{ "hi" | shout | upper }}</p>`))
+	Need(t, err == nil)
+
+	buf := new(bytes.Buffer)
+	err = tpl.Apply(buf, map[string]any{})
+
+	Need(t, err == nil)
+	Want(t, buf.String() == "<p>HI!</p>")
+}
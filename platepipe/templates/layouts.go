@@ -0,0 +1,146 @@
+package templates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/documents"
+)
+
+// part is a file parsed into a template: the template itself or one of the
+// layouts it extends, see the package documentation.
+type part struct {
+	source
+	body []byte
+	data map[string]any
+}
+
+// loadLayouts returns the layouts extended by the given template, from the
+// outermost to the innermost, followed by the template itself.
+func loadLayouts(t part) ([]part, error) {
+	parts := []part{t}
+
+	for {
+		name, ok := parts[0].data["layout"].(string)
+		if !ok {
+			return parts, nil
+		}
+
+		file, err := find("layout", name, parts[0].file)
+		if err != nil {
+			return nil, diagnostics.New(diagnostics.KindIO, parts[0].file,
+				fmt.Errorf("%s: %w", parts[0].name, err))
+		}
+
+		chain := []string{}
+		for i := len(parts) - 1; i >= 0; i-- {
+			chain = append(chain, parts[i].name)
+			if filepath.Clean(parts[i].file) == file {
+				return nil, diagnostics.New(diagnostics.KindMetadata,
+					parts[0].file, fmt.Errorf("layout cycle: %s -> %s",
+						strings.Join(chain, " -> "), file))
+			}
+		}
+
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return nil, diagnostics.New(diagnostics.KindIO, file, err)
+		}
+
+		content, data, line := documents.Split(buf)
+		layout := part{source{file, file, line}, content, data}
+
+		parts = append([]part{layout}, parts...)
+	}
+}
+
+// layoutPartial prefixes the names under which the partial function is
+// registered for the layouts of a template, see partialFunc.
+const layoutPartial = "_layoutPartial"
+
+// layoutPartialRE matches the names of the partial function of layouts in
+// error messages, which refer to it as "partial", see Template.error.
+var layoutPartialRE = regexp.MustCompile(layoutPartial + `\d+`)
+
+// partialFunc returns the name of the partial function of the i-th of parts,
+// a template and its layouts. Each layout has its own partial function, which
+// looks up partials from the directory of the layout, as the template's
+// partial function does from the directory of the template. The calls to
+// partial parsed from layouts are renamed to it, see renamePartials.
+func partialFunc(parts []part, i int) string {
+	if i == len(parts)-1 {
+		return "partial"
+	}
+
+	return layoutPartial + strconv.Itoa(i)
+}
+
+// isPartialFunc tells whether name is the name of a partial function, see
+// partialFunc.
+func isPartialFunc(name string) bool {
+	return name == "partial" || strings.HasPrefix(name, layoutPartial)
+}
+
+// renamePartials renames the calls to the partial function in tree, if it was
+// parsed from one of the layouts in parts, to the partial function of the
+// layout, see partialFunc.
+func renamePartials(tree *parse.Tree, parts []part) {
+	if tree == nil {
+		return
+	}
+
+	for i, p := range parts[:len(parts)-1] {
+		if p.name == tree.ParseName {
+			renamePartialCalls(tree.Root, partialFunc(parts, i))
+		}
+	}
+}
+
+func renamePartialCalls(node parse.Node, name string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			renamePartialCalls(c, name)
+		}
+	case *parse.ActionNode:
+		renamePartialCalls(n.Pipe, name)
+	case *parse.IfNode:
+		renamePartialCalls(&n.BranchNode, name)
+	case *parse.RangeNode:
+		renamePartialCalls(&n.BranchNode, name)
+	case *parse.WithNode:
+		renamePartialCalls(&n.BranchNode, name)
+	case *parse.BranchNode:
+		renamePartialCalls(n.Pipe, name)
+		renamePartialCalls(n.List, name)
+		renamePartialCalls(n.ElseList, name)
+	case *parse.TemplateNode:
+		renamePartialCalls(n.Pipe, name)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			renamePartialCalls(c, name)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			renamePartialCalls(a, name)
+		}
+	case *parse.ChainNode:
+		renamePartialCalls(n.Node, name)
+	case *parse.IdentifierNode:
+		if n.Ident == "partial" {
+			n.Ident = name
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package templates_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/templates"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestLayouts(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		Need(t, os.WriteFile(p, []byte(content), 0o600) == nil)
+		return p
+	}
+
+	base := write("base.html", "site = 'S'\ntitle = 'base'\n\n"+
+		`<title>{{ .title }} - {{ .site }}</title>`+
+		`<main>{{ block "main" . }}default{{ end }}</main>`+
+		`{{ block "footer" . }}<footer>{{ .site }}</footer>{{ end }}`)
+	write("section.html", "layout = 'base.html'\nsection = 'sec'\n\n"+
+		`{{ define "footer" }}<footer>{{ .section }}</footer>{{ end }}`)
+	page := write("page.html", "layout = 'section.html'\ntitle = 'page'\n\n"+
+		`ignored{{ define "main" }}<p>{{ .content }}</p>{{ end }}`)
+	bad := write("bad.html", "layout = 'broken.html'\n\n"+
+		`{{ define "main" }}{{ if .fail }}{{ add "a" 1 }}{{ end }}{{ end }}`)
+	broken := write("broken.html", "k = 1\n\n<p>\n{{ template \"main\" . }}\n"+
+		"{{ .content.field }}</p>")
+	write("cycle1.html", "layout = 'cycle2.html'\n\n")
+	write("cycle2.html", "layout = 'cycle1.html'\n\n")
+
+	t.Run("inheritance", func(t *testing.T) {
+		tpl, data, err := templates.FromFile(page)
+		Need(t, err == nil)
+
+		Want(t, data["title"] == "page")
+		Want(t, data["site"] == "S")
+		Want(t, data["section"] == "sec")
+
+		data["content"] = "<c>"
+		buf := new(bytes.Buffer)
+		err = tpl.Apply(buf, data)
+
+		Need(t, err == nil)
+		Want(t, buf.String() == "<title>page - S</title>"+
+			"<main><p>&lt;c&gt;</p></main><footer>sec</footer>")
+		Want(t, strings.Join(tpl.Dependencies(), ",") ==
+			base+","+filepath.Join(dir, "section.html"))
+	})
+
+	t.Run("errors in layouts", func(t *testing.T) {
+		tpl, data, err := templates.FromFile(bad)
+		Need(t, err == nil)
+
+		data["content"] = "text"
+		data["fail"] = true
+		err = tpl.Apply(new(bytes.Buffer), data)
+
+		var d *diagnostics.Error
+		Need(t, errors.As(err, &d))
+		Want(t, d.File == bad)
+		Want(t, d.Line == 3)
+		Want(t, strings.HasPrefix(err.Error(), "template: "+bad+":3:"))
+
+		data["fail"] = false
+		err = tpl.Apply(new(bytes.Buffer), data)
+
+		Need(t, errors.As(err, &d))
+		Want(t, d.File == broken)
+		Want(t, d.Line == 5)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		_, _, err := templates.FromFile(filepath.Join(dir, "cycle1.html"))
+
+		Need(t, err != nil)
+		Want(t, strings.HasPrefix(err.Error(), "layout cycle: "))
+	})
+
+	t.Run("partials", func(t *testing.T) {
+		theme := filepath.Join(dir, "theme")
+		Need(t, os.MkdirAll(theme, 0o700) == nil)
+
+		write("theme/layout.txt", "menu = 'm'\n\n"+
+			`[{{ partial "nav.txt" . }}]{{ block "main" . }}{{ end }}`+
+			`{{ partial "missing.txt" . }}`)
+		write("theme/nav.txt", "theme nav")
+		write("nav.txt", "page nav")
+		write("missing.txt", "")
+		themed := write("themed.txt", "layout = 'theme/layout.txt'\n\n"+
+			`{{ define "main" }}{{ partial "nav.txt" . }}{{ .content }}`+
+			`{{ end }}`)
+
+		tpl, _, err := templates.FromFile(themed)
+		Need(t, err == nil)
+
+		err = tpl.Apply(new(bytes.Buffer), map[string]any{"content": "c"})
+
+		Need(t, err != nil)
+		Want(t, strings.Contains(err.Error(), `error calling partial: `+
+			`partial "missing.txt" not found in `+theme))
+
+		Need(t, os.WriteFile(filepath.Join(theme, "missing.txt"), nil,
+			0o600) == nil)
+
+		buf := new(bytes.Buffer)
+		err = tpl.Apply(buf, map[string]any{"content": "c"})
+
+		Need(t, err == nil)
+		Want(t, buf.String() == "[theme nav]page navc")
+
+		problems := templates.Lint([]*templates.Template{tpl})
+
+		Need(t, len(problems) == 1)
+		Want(t, problems[0].File == filepath.Join(theme, "layout.txt"))
+		Want(t, strings.HasSuffix(problems[0].Error(),
+			`layout.txt: header variable "menu" is not used by any template`))
+	})
+}
@@ -0,0 +1,415 @@
+package templates
+
+import (
+	"fmt"
+	"sort"
+	"text/template/parse"
+
+	htemplate "html/template"
+	ttemplate "text/template"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+)
+
+// settingKeys are the metadata header keys that configure templates, see the
+// package documentation, documents, see RenderDocument and markdown.Config,
+// collections, their pagination and taxonomies, see the collections package,
+// feeds, see the feeds package, sitemaps, see the sitemaps package, and search
+// indexes, see the search package. These are not reported as unused by Lint.
+var settingKeys = map[string]bool{
+	"strict":      true,
+	"requires":    true,
+	"layout":      true,
+	"template":    true,
+	"markdown":    true,
+	"collections": true,
+	"paginate":    true,
+	"taxonomies":  true,
+	"feeds":       true,
+	"sitemap":     true,
+	"search":      true,
+}
+
+// Layer is a source of template variables other than the metadata headers of
+// the templates themselves, such as the header of a document or a variables
+// file, for the purpose of linting.
+type Layer struct {
+	File  string
+	Stage int // pipeline stage, see diagnostics.Error
+	Data  map[string]any
+
+	// Header tells whether variables that no template uses are reported.
+	Header bool
+
+	// Uses lists the variables read by the settings of the layer, e.g., the
+	// metadata keys of taxonomies, which are not reported as unused.
+	Uses []string
+}
+
+// Lint statically analyses a chain of templates, applied in order to the
+// output of the previous one, which is passed in the "content" variable. The
+// variables available to the chain are those defined in the headers of its
+// templates, the variables declared with defaults in their requirements, and
+// the variables of the given layers.
+//
+// Lint works without rendering, by walking the parse trees of the templates,
+// and reports:
+//
+//   - references to variables that no layer defines (warnings), except when
+//     used as the condition of an if or with action, the idiomatic way to
+//     check for optional variables;
+//   - header variables that no template references, nor the settings of
+//     any layer use (warnings);
+//   - templates that ignore .content, dropping the output of the previous
+//     stage (warnings);
+//   - calls to undefined templates and partials not found (errors).
+//
+// Templates in the chain are reported as pipeline stages 1 to n. Variables
+// are only tracked where dot is the data passed to the template, i.e., not
+// within range and with actions, unless referenced as $.name. Templates that
+// use the data as a whole, e.g., {{ range $k, $v := . }}, are assumed to use
+// every variable. Partials called with a constant name are analysed as part
+// of the template calling them, when called with dot as their data.
+func Lint(chain []*Template, layers ...Layer) []*diagnostics.Error {
+	ret := []*diagnostics.Error{}
+
+	defined := map[string]bool{"content": true}
+	for _, l := range layers {
+		for k := range l.Data {
+			defined[k] = true
+		}
+	}
+	for _, t := range chain {
+		for _, k := range t.keys {
+			defined[k] = true
+		}
+		for _, req := range t.requires {
+			if req.Default != nil {
+				defined[req.Name] = true
+			}
+		}
+	}
+
+	used := map[string]bool{}
+	usesAll := false
+
+	for _, l := range layers {
+		for _, k := range l.Uses {
+			used[k] = true
+		}
+	}
+
+	for i, t := range chain {
+		stage := i + 1
+		refs := t.references()
+
+		for _, f := range refs.fields {
+			used[f.name] = true
+			if defined[f.name] || refs.guarded[f.name] {
+				continue
+			}
+			ret = append(ret, f.lintError(stage, diagnostics.SeverityWarning,
+				"variable .%s is not defined by any layer", f.name))
+		}
+
+		for _, c := range refs.undefined {
+			ret = append(ret, c.lintError(stage, diagnostics.SeverityError,
+				"%s", c.name))
+		}
+
+		usesAll = usesAll || refs.whole
+		if !refs.whole && !refs.uses("content") {
+			e := diagnostics.New(diagnostics.KindLint, t.file, fmt.Errorf(
+				"%s: template ignores .content, dropping the output of the "+
+					"previous stage", t.name))
+			e.Severity = diagnostics.SeverityWarning
+			e.Stage = stage
+			ret = append(ret, e)
+		}
+	}
+
+	if usesAll {
+		return ret
+	}
+
+	for i, t := range chain {
+		for _, k := range t.keys {
+			if !used[k] && !settingKeys[k] {
+				src := t.keySources[k]
+				ret = append(ret, unusedError(src.file, src.name, i+1, k))
+			}
+		}
+	}
+
+	for _, l := range layers {
+		if !l.Header {
+			continue
+		}
+
+		keys := []string{}
+		for k := range l.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if !used[k] && !settingKeys[k] {
+				ret = append(ret, unusedError(l.File, l.File, l.Stage, k))
+			}
+		}
+	}
+
+	return ret
+}
+
+func unusedError(file, name string, stage int, key string) *diagnostics.Error {
+	e := diagnostics.New(diagnostics.KindLint, file, fmt.Errorf(
+		"%s: header variable %q is not used by any template", name, key))
+	e.Severity = diagnostics.SeverityWarning
+	e.Stage = stage
+
+	return e
+}
+
+func (r reference) lintError(
+	stage int, severity diagnostics.Severity, format string, args ...any,
+) *diagnostics.Error {
+	src := r.t.sourceNamed(r.tree.ParseName)
+
+	loc, _ := r.tree.ErrorContext(r.node)
+	line, col := diagnostics.Locate(loc, r.tree.ParseName+":")
+	line += src.line
+
+	e := diagnostics.New(diagnostics.KindLint, src.file, fmt.Errorf(
+		"%s:%d:%d: "+format, append([]any{src.name, line, col}, args...)...))
+	e.Line, e.Column = line, col
+	e.Severity = severity
+	e.Stage = stage
+
+	return e
+}
+
+// reference is a node of a parse tree of template t that references a
+// variable or template by name.
+type reference struct {
+	name string
+	t    *Template
+	tree *parse.Tree
+	node parse.Node
+}
+
+// references holds the variables and templates referenced by a template.
+type references struct {
+	fields    []reference     // variables, in order of appearance
+	guarded   map[string]bool // variables checked in if and with actions
+	undefined []reference     // calls to undefined templates, as messages
+	whole     bool            // whether the data is used as a whole
+}
+
+func (r *references) uses(name string) bool {
+	for _, f := range r.fields {
+		if f.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trees returns the parse trees of the template and all the templates it
+// defines, by name.
+func (t *Template) trees() map[string]*parse.Tree {
+	ret := map[string]*parse.Tree{}
+
+	switch st := t.stdTemplate.(type) {
+	case *htemplate.Template:
+		for _, a := range st.Templates() {
+			ret[a.Name()] = a.Tree
+		}
+	case *ttemplate.Template:
+		for _, a := range st.Templates() {
+			ret[a.Name()] = a.Tree
+		}
+	}
+
+	return ret
+}
+
+func (t *Template) references() *references {
+	r := &references{guarded: map[string]bool{}}
+	t.walk(r, map[*Template]bool{})
+
+	return r
+}
+
+// walk collects the references of t and the partials it calls, unless already
+// visited.
+func (t *Template) walk(r *references, visited map[*Template]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+
+	trees := t.trees()
+
+	names := []string{}
+	for name := range trees {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tree := trees[name]
+		if tree == nil || tree.Root == nil {
+			continue
+		}
+
+		w := &walker{t, tree, trees, r, visited}
+		w.walk(tree.Root, true)
+	}
+}
+
+// walker collects the references in a parse tree. Templates defined in the
+// same file are assumed to be called with the template's data as dot.
+type walker struct {
+	t       *Template
+	tree    *parse.Tree
+	trees   map[string]*parse.Tree
+	refs    *references
+	visited map[*Template]bool
+}
+
+// walk collects the references in node; root tells whether dot is the data
+// passed to the template.
+func (w *walker) walk(node parse.Node, root bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			w.walk(c, root)
+		}
+	case *parse.ActionNode:
+		w.walk(n.Pipe, root)
+	case *parse.IfNode:
+		w.guard(n.Pipe, root)
+		w.walk(n.Pipe, root)
+		w.walk(n.List, root)
+		w.walk(n.ElseList, root)
+	case *parse.RangeNode:
+		w.walk(n.Pipe, root)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, root)
+	case *parse.WithNode:
+		w.guard(n.Pipe, root)
+		w.walk(n.Pipe, root)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, root)
+	case *parse.TemplateNode:
+		if _, ok := w.trees[n.Name]; !ok {
+			w.refs.undefined = append(w.refs.undefined, reference{
+				fmt.Sprintf("template %q is not defined", n.Name),
+				w.t, w.tree, n,
+			})
+		}
+		if n.Pipe != nil && isDot(n.Pipe) {
+			return // the called template is walked with dot as root
+		}
+		w.walk(n.Pipe, root)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			w.walk(c, root)
+		}
+	case *parse.CommandNode:
+		if w.partial(n, root) {
+			return
+		}
+		for _, a := range n.Args {
+			w.walk(a, root)
+		}
+	case *parse.ChainNode:
+		w.walk(n.Node, root)
+	case *parse.FieldNode:
+		if root {
+			w.field(n.Ident[0], n)
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] != "$" {
+			return
+		}
+		if len(n.Ident) > 1 {
+			w.field(n.Ident[1], n)
+		} else {
+			w.refs.whole = true
+		}
+	case *parse.DotNode:
+		if root {
+			w.refs.whole = true
+		}
+	}
+}
+
+func (w *walker) field(name string, node parse.Node) {
+	w.refs.fields = append(w.refs.fields, reference{name, w.t, w.tree, node})
+}
+
+// partial walks the partial called by cmd, if cmd is a call to the partial
+// function with a constant name, and tells whether the data argument was
+// walked as part of it, i.e., if it is dot.
+func (w *walker) partial(cmd *parse.CommandNode, root bool) bool {
+	if len(cmd.Args) != 3 {
+		return false
+	}
+
+	fn, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok || !isPartialFunc(fn.Ident) {
+		return false
+	}
+
+	name, ok := cmd.Args[1].(*parse.StringNode)
+	if !ok {
+		return false
+	}
+
+	p, err := w.t.loadPartial(name.Text,
+		w.t.sourceNamed(w.tree.ParseName).file)
+	if err != nil {
+		w.refs.undefined = append(w.refs.undefined,
+			reference{err.Error(), w.t, w.tree, name})
+		return false
+	}
+
+	if _, dot := cmd.Args[2].(*parse.DotNode); !dot || !root {
+		return false
+	}
+
+	p.walk(w.refs, w.visited)
+
+	return true
+}
+
+// guard records the variable checked by an if or with action, when it is the
+// only thing in the pipeline, e.g., {{ if .name }}.
+func (w *walker) guard(pipe *parse.PipeNode, root bool) {
+	if !root || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return
+	}
+
+	if f, ok := pipe.Cmds[0].Args[0].(*parse.FieldNode); ok {
+		w.refs.guarded[f.Ident[0]] = true
+	}
+}
+
+func isDot(pipe *parse.PipeNode) bool {
+	if len(pipe.Decl) != 0 || len(pipe.Cmds) != 1 ||
+		len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+
+	_, ok := pipe.Cmds[0].Args[0].(*parse.DotNode)
+	return ok
+}
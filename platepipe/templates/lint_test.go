@@ -0,0 +1,106 @@
+package templates_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/templates"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestLint(t *testing.T) {
+	load := func(s string) *templates.Template {
+		tpl, _, err := templates.TextTemplateFromStream(
+			bytes.NewBufferString(s))
+		Need(t, err == nil)
+		return tpl
+	}
+
+	messages := func(problems []*diagnostics.Error) []string {
+		ret := []string{}
+		for _, p := range problems {
+			ret = append(ret, fmt.Sprintf("%d %s %s",
+				p.Stage, p.Severity, p.Error()))
+		}
+		return ret
+	}
+
+	t.Run("clean chain", func(t *testing.T) {
+		chain := []*templates.Template{
+			load("title = 'x'\n\n{{ .title }} {{ .content }}"),
+			load("{{ if .opt }}{{ .opt }}{{ end }}{{ .content }} {{ .doc }}"),
+		}
+
+		problems := templates.Lint(chain, templates.Layer{
+			File: "doc.md", Data: map[string]any{"doc": 1}, Header: true,
+		})
+
+		Want(t, len(problems) == 0)
+	})
+
+	t.Run("problems", func(t *testing.T) {
+		chain := []*templates.Template{
+			load("unused = 1\nstrict = true\n\n{{ .content }}\n" +
+				"{{ .missing }}{{ range .list }}{{ .item }}{{ end }}"),
+			load("{{ with .a }}{{ .b }}{{ end }}{{ template \"x\" . }}"),
+		}
+
+		problems := templates.Lint(chain,
+			templates.Layer{
+				File: "doc.md", Data: map[string]any{"list": 1, "a": 2,
+					"extra": 3}, Header: true,
+			},
+			templates.Layer{Data: map[string]any{"vars": 1}},
+		)
+
+		msgs := messages(problems)
+		name := chain[0].Name()
+
+		Need(t, len(msgs) == 5)
+		Want(t, msgs[0] == "1 warning "+name+
+			":5:3: variable .missing is not defined by any layer")
+		Want(t, msgs[1] == "2 error "+chain[1].Name()+
+			`:1:42: template "x" is not defined`)
+		Want(t, msgs[2] == "2 warning "+chain[1].Name()+
+			": template ignores .content, dropping the output of the "+
+			"previous stage")
+		Want(t, msgs[3] == "1 warning "+name+
+			`: header variable "unused" is not used by any template`)
+		Want(t, msgs[4] == "0 warning doc.md: "+
+			`header variable "extra" is not used by any template`)
+	})
+
+	t.Run("variables used by settings", func(t *testing.T) {
+		chain := []*templates.Template{
+			load("taxonomies.tags = {}\n\n{{ .content }}"),
+		}
+
+		problems := templates.Lint(chain,
+			templates.Layer{Uses: []string{"tags"}},
+			templates.Layer{
+				File: "doc.md", Data: map[string]any{"tags": 1, "extra": 2},
+				Header: true,
+			},
+		)
+
+		msgs := messages(problems)
+
+		Need(t, len(msgs) == 1)
+		Want(t, msgs[0] == "0 warning doc.md: "+
+			`header variable "extra" is not used by any template`)
+	})
+
+	t.Run("data used as a whole", func(t *testing.T) {
+		chain := []*templates.Template{
+			load("unused = 1\n\n{{ range $k, $v := . }}{{ $k }}{{ end }}"),
+		}
+
+		problems := templates.Lint(chain, templates.Layer{
+			File: "doc.md", Data: map[string]any{"extra": 1}, Header: true,
+		})
+
+		Want(t, len(problems) == 0)
+	})
+}
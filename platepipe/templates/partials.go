@@ -0,0 +1,159 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SearchPath lists the directories where partials and layouts are looked up,
+// after the directory of the template or layout referencing them (the current
+// directory for templates not loaded from a file).
+//
+// Partials are templates rendered by other templates, through the partial
+// function, e.g., {{ partial "nav.html" . }}, which takes the name of the
+// partial file and the data to render it with. Partials are parsed with the
+// same package (text/template or html/template) as the template calling them,
+// regardless of their file extension, and only once. Their metadata headers,
+// if any, configure the partial as usual, but their variables are not used.
+//
+// In HTML templates, partial returns template.HTML values, which are not
+// escaped again, as they were escaped when rendering the partial.
+//
+// Changing the search path should be done before rendering templates.
+var SearchPath []string
+
+// MaxPartialDepth is the maximum number of renderings of a partial in
+// progress at once, which partials calling themselves, directly or through
+// other partials, e.g., to render nested menus, must not exceed.
+var MaxPartialDepth = 100
+
+// partialCycle is the error returned when a partial exceeds MaxPartialDepth,
+// naming the partials called from the first to the last rendering of the
+// partial, which is built as the error is returned through them.
+type partialCycle struct {
+	chain  []string
+	closed bool
+}
+
+func (e *partialCycle) Error() string {
+	return fmt.Sprintf("partials nested more than %d levels deep: %s",
+		MaxPartialDepth, strings.Join(e.chain, " -> "))
+}
+
+// partialCache holds the partials parsed by one of the template packages, by
+// path.
+type partialCache struct {
+	mutex     sync.Mutex
+	templates map[string]*Template
+}
+
+var (
+	htmlPartials = &partialCache{templates: map[string]*Template{}}
+	textPartials = &partialCache{templates: map[string]*Template{}}
+)
+
+// find returns the path of the named partial or layout (what), searching the
+// directory of the file from which it is referenced and then SearchPath.
+func find(what, name, from string) (string, error) {
+	dirs := append([]string{filepath.Dir(from)}, SearchPath...)
+
+	for _, dir := range dirs {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s %q not found in %s",
+		what, name, strings.Join(dirs, ", "))
+}
+
+// loadPartial returns the named partial, referenced from the given file,
+// parsing it if not yet cached.
+func (t *Template) loadPartial(name, from string) (*Template, error) {
+	p, err := find("partial", name, from)
+	if err != nil {
+		return nil, err
+	}
+
+	t.partials.mutex.Lock()
+	defer t.partials.mutex.Unlock()
+
+	if ret, ok := t.partials.templates[p]; ok {
+		return ret, nil
+	}
+
+	ret, _, err := fromFile(p, t.newPartial)
+	if err != nil {
+		return nil, err
+	}
+	t.partials.templates[p] = ret
+
+	return ret, nil
+}
+
+// partial implements the partial template function, called from the given
+// file, the template's own file or that of one of its layouts.
+func (t *Template) partial(name, from string, data any) (string, error) {
+	p, err := t.loadPartial(name, from)
+	if err != nil {
+		return "", err
+	}
+
+	if p.depth.Add(1) > int32(MaxPartialDepth) {
+		p.depth.Add(-1)
+		return "", &partialCycle{chain: []string{name}}
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = p.execute(buf, data)
+	p.depth.Add(-1)
+
+	var cycle *partialCycle
+	if errors.As(err, &cycle) {
+		if !cycle.closed {
+			cycle.chain = append([]string{name}, cycle.chain...)
+			cycle.closed = name == cycle.chain[len(cycle.chain)-1]
+		}
+
+		// report the chain once, rather than nested in the errors of every
+		// partial in the chain
+		return "", cycle
+	}
+	if err != nil {
+		return "", err
+	}
+
+	deps := append(p.Dependencies(), p.file)
+
+	t.depsMutex.Lock()
+	defer t.depsMutex.Unlock()
+
+	for _, d := range deps {
+		t.deps[d] = true
+	}
+
+	return buf.String(), nil
+}
+
+// Dependencies returns the files, other than the template's own file, used
+// when rendering the template so far, such as partials, sorted.
+func (t *Template) Dependencies() []string {
+	t.depsMutex.Lock()
+	defer t.depsMutex.Unlock()
+
+	ret := []string{}
+	for d := range t.deps {
+		ret = append(ret, d)
+	}
+	sort.Strings(ret)
+
+	return ret
+}
@@ -0,0 +1,131 @@
+package templates_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cdop.pt/go/free/platepipe/templates"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestPartials(t *testing.T) {
+	dir := t.TempDir()
+	include := t.TempDir()
+
+	write := func(dir, name, content string) string {
+		p := filepath.Join(dir, name)
+		Need(t, os.WriteFile(p, []byte(content), 0o600) == nil)
+		return p
+	}
+
+	page := write(dir, "page.html",
+		`<main>{{ partial "nav.html" . }}{{ partial "nav.html" . }}</main>`)
+	text := write(dir, "page.txt", `{{ partial "nav.html" . }}`)
+	write(dir, "nav.html",
+		"key = 1\n\n<nav>{{ .title }}{{ partial \"item.html\" .title }}</nav>")
+	item := write(include, "item.html", "<i>{{ . }}</i>")
+	broken := write(dir, "broken.txt", `{{ partial "nope.txt" . }}`)
+
+	templates.SearchPath = []string{include}
+	defer func() { templates.SearchPath = nil }()
+
+	t.Run("html", func(t *testing.T) {
+		tpl, _, err := templates.FromFile(page)
+		Need(t, err == nil)
+
+		buf := new(bytes.Buffer)
+		err = tpl.Apply(buf, map[string]any{"title": "<T>"})
+
+		Need(t, err == nil)
+		Want(t, buf.String() == "<main>"+
+			"<nav>&lt;T&gt;<i>&lt;T&gt;</i></nav>"+
+			"<nav>&lt;T&gt;<i>&lt;T&gt;</i></nav></main>")
+		Want(t, strings.Join(tpl.Dependencies(), ",") ==
+			strings.Join([]string{filepath.Join(dir, "nav.html"), item}, ","))
+	})
+
+	t.Run("text", func(t *testing.T) {
+		tpl, _, err := templates.FromFile(text)
+		Need(t, err == nil)
+
+		buf := new(bytes.Buffer)
+		err = tpl.Apply(buf, map[string]any{"title": "<T>"})
+
+		Need(t, err == nil)
+		Want(t, buf.String() == "<nav><T><i><T></i></nav>")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		tpl, _, err := templates.FromFile(broken)
+		Need(t, err == nil)
+
+		err = tpl.Apply(new(bytes.Buffer), map[string]any{})
+
+		Need(t, err != nil)
+		Want(t, strings.HasSuffix(err.Error(), `partial "nope.txt" not found in `+
+			dir+", "+include))
+	})
+
+	t.Run("lint", func(t *testing.T) {
+		tpl, _, err := templates.FromFile(broken)
+		Need(t, err == nil)
+
+		problems := templates.Lint([]*templates.Template{tpl})
+
+		Need(t, len(problems) == 1)
+		Want(t, strings.HasSuffix(problems[0].Error(), `partial "nope.txt" `+
+			"not found in "+dir+", "+include))
+
+		tpl, _, err = templates.FromFile(page)
+		Need(t, err == nil)
+
+		problems = templates.Lint([]*templates.Template{tpl})
+
+		Need(t, len(problems) == 3)
+		Want(t, strings.HasSuffix(problems[0].Error(),
+			"nav.html:3:8: variable .title is not defined by any layer"))
+		Want(t, strings.HasSuffix(problems[1].Error(),
+			"nav.html:3:40: variable .title is not defined by any layer"))
+		Want(t, strings.HasSuffix(problems[2].Error(),
+			"page.html: template ignores .content, dropping the output of "+
+				"the previous stage"))
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		loop := write(dir, "loop.txt", `{{ partial "a.txt" . }}`)
+		write(dir, "a.txt", `a{{ partial "b.txt" . }}`)
+		write(dir, "b.txt", `b{{ partial "a.txt" . }}`)
+
+		tpl, _, err := templates.FromFile(loop)
+		Need(t, err == nil)
+
+		err = tpl.Apply(new(bytes.Buffer), map[string]any{})
+
+		Need(t, err != nil)
+		Want(t, strings.HasSuffix(err.Error(), "partials nested more than "+
+			"100 levels deep: a.txt -> b.txt -> a.txt"))
+	})
+
+	t.Run("recursion", func(t *testing.T) {
+		tree := write(dir, "tree.txt", `{{ partial "node.txt" .root }}`)
+		write(dir, "node.txt",
+			`({{ range .children }}{{ partial "node.txt" . }}{{ end }})`)
+
+		tpl, _, err := templates.FromFile(tree)
+		Need(t, err == nil)
+
+		leaf := map[string]any{}
+		node := map[string]any{"children": []any{leaf, leaf}}
+
+		buf := new(bytes.Buffer)
+		err = tpl.Apply(buf, map[string]any{
+			"root": map[string]any{"children": []any{node}},
+		})
+
+		Need(t, err == nil)
+		Want(t, buf.String() == "((()()))")
+	})
+}
@@ -0,0 +1,178 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+)
+
+// Requirement is a variable that a template expects to be defined when it is
+// applied, as declared in the "requires" table of its metadata header.
+//
+// Requirements are declared with the name of the expected type, optionally
+// followed by "?" when the variable may be undefined, or with a table holding
+// the type and a default value for the variable:
+//
+//	requires.title = "string"
+//	requires.date = "datetime"
+//	requires.tags = "array?"
+//	requires.lang = { type = "string", default = "en" }
+//
+// A [requires] table works as well, but not as the first line of the header,
+// which must start with a key, as explained in the metadata package.
+//
+// Known types are "string", "integer", "float", "number" (integer or float),
+// "boolean", "datetime", "array", "table" and "any".
+type Requirement struct {
+	Name     string
+	Type     string
+	Optional bool
+	Default  any // nil when there is no default value
+}
+
+var requirementTypes = map[string]func(reflect.Value) bool{
+	"string": func(v reflect.Value) bool {
+		return v.Kind() == reflect.String
+	},
+	"integer": isInteger,
+	"float":   isFloat,
+	"number": func(v reflect.Value) bool {
+		return isInteger(v) || isFloat(v)
+	},
+	"boolean": func(v reflect.Value) bool {
+		return v.Kind() == reflect.Bool
+	},
+	"datetime": func(v reflect.Value) bool {
+		_, ok := v.Interface().(time.Time)
+		return ok
+	},
+	"array": func(v reflect.Value) bool {
+		return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+	},
+	"table": func(v reflect.Value) bool {
+		return v.Kind() == reflect.Map
+	},
+	"any": func(reflect.Value) bool {
+		return true
+	},
+}
+
+func isInteger(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+func isFloat(v reflect.Value) bool {
+	return v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+// parseRequirements reads the requirements declared in a metadata header,
+// sorted by variable name.
+func parseRequirements(data map[string]any) ([]Requirement, error) {
+	if _, ok := data["requires"]; !ok {
+		return nil, nil
+	}
+
+	decls, ok := data["requires"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf(`"requires" must be a table`)
+	}
+
+	names := []string{}
+	for name := range decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := []Requirement{}
+	for _, name := range names {
+		decl := decls[name]
+		req := Requirement{Name: name}
+
+		switch decl := decl.(type) {
+		case string:
+			req.Type = decl
+		case map[string]any:
+			req.Type, _ = decl["type"].(string)
+			if v, ok := decl["default"]; ok {
+				req.Default = v
+				req.Optional = true
+			}
+		default:
+			return nil, fmt.Errorf(
+				"requirement %q must be a type name or a table", name)
+		}
+
+		if strings.HasSuffix(req.Type, "?") {
+			req.Type = req.Type[:len(req.Type)-1]
+			req.Optional = true
+		}
+
+		if _, ok := requirementTypes[req.Type]; !ok {
+			return nil, fmt.Errorf(
+				"requirement %q has unknown type %q", name, req.Type)
+		}
+
+		ret = append(ret, req)
+	}
+
+	return ret, nil
+}
+
+// Requirements returns the variables that the template expects to be defined
+// when it is applied, sorted by name.
+func (t *Template) Requirements() []Requirement {
+	return t.requires
+}
+
+// CheckRequirements checks data against the requirements of all the given
+// templates, and sets the default values of undefined variables that have one.
+//
+// All missing and mistyped variables are reported together, as a joined
+// error of *diagnostics.Error values, one per problem.
+func CheckRequirements(data map[string]any, chain ...*Template) error {
+	errs := []error{}
+
+	for _, t := range chain {
+		for _, req := range t.requires {
+			v, defined := data[req.Name]
+
+			if !defined && req.Default != nil {
+				data[req.Name] = req.Default
+				continue
+			}
+
+			if !defined && req.Optional {
+				continue
+			}
+
+			var err error
+			if !defined {
+				err = fmt.Errorf("%s: missing required variable %q of type %s",
+					t.name, req.Name, req.Type)
+			} else if rv := reflect.ValueOf(v); !rv.IsValid() ||
+				!requirementTypes[req.Type](rv) {
+				err = fmt.Errorf("%s: variable %q must be of type %s, not %T",
+					t.name, req.Name, req.Type, v)
+			} else {
+				continue
+			}
+
+			errs = append(errs,
+				diagnostics.New(diagnostics.KindRequirement, t.file, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
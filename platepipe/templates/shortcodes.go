@@ -0,0 +1,525 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+)
+
+// ShortcodePath lists the directories where shortcode templates are looked
+// up, in order.
+//
+// Shortcodes are references to templates in documents, with parameters, such
+// as {{< figure src="x.png" caption="A figure" >}}, which renders the
+// template figure.html, or figure.txt, found in ShortcodePath, in place of the
+// reference. Paired shortcodes, such as {{< note >}}*Markdown*{{< /note >}},
+// also pass the content between their opening and closing tags to their
+// template, with any shortcodes in it expanded. Shortcode templates are
+// rendered with the following variables:
+//
+//	.name   the name of the shortcode
+//	.params named parameters, e.g., {{ .params.src }}
+//	.args   positional parameters, e.g., {{ index .args 0 }}
+//	.inner  the content of paired shortcodes, e.g., {{ markdownify .inner }}
+//	.page   the variables the document is rendered with
+//
+// Parameter values are strings, quoted if they contain spaces or quotes.
+// Standalone shortcodes may be closed explicitly, e.g., {{< toc />}}, to
+// tell them apart from paired shortcodes with the same name. Shortcodes are
+// written literally when commented out, e.g.,
+// {{</* figure */>}} renders {{< figure >}}, and in fenced code blocks and
+// code spans, where only comments are removed.
+//
+// Shortcodes are only expanded if the search path is not empty. Changing the
+// search path should be done before expanding shortcodes.
+var ShortcodePath []string
+
+var shortcodeTemplates = &partialCache{templates: map[string]*Template{}}
+
+var shortcodeParamRegexp = regexp.MustCompile(
+	`^\s*(?:([\w-]+)=)?("(?:[^"\\]|\\.)*"|[^\s"]+)`)
+
+// Shortcodes holds the expansions of the shortcodes of a document, while the
+// document is converted, see ExpandShortcodes.
+type Shortcodes struct {
+	expansions [][]byte
+}
+
+// ExpandShortcodes renders the shortcodes in the body of a document, loaded
+// from file, with data available to their templates as .page, and replaces
+// them with placeholders, which Restore replaces with the rendered
+// shortcodes. Placeholders are plain words, so that the output of shortcodes
+// is not processed, e.g., escaped, when converting the body from Markdown to
+// HTML in between. Errors refer to lines of file, offset by the line lines
+// taken by its metadata header. The body is returned unchanged if
+// ShortcodePath is empty.
+func ExpandShortcodes(
+	file string, body []byte, line int, data map[string]any,
+) ([]byte, *Shortcodes, error) {
+	ret := &Shortcodes{}
+
+	if len(ShortcodePath) == 0 || !bytes.Contains(body, []byte("{{<")) {
+		return body, ret, nil
+	}
+
+	x := &expansion{file: file, body: body, line: line, data: data,
+		code: code(body)}
+
+	roots, err := x.parse()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := new(bytes.Buffer)
+	pos := 0
+
+	for _, n := range roots {
+		out.Write(body[pos:n.start])
+		pos = n.stop()
+
+		if n.literal != "" {
+			out.WriteString(n.literal)
+			continue
+		}
+
+		buf, err := x.render(n)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		out.WriteString(placeholder(len(ret.expansions)))
+		ret.expansions = append(ret.expansions, buf)
+	}
+	out.Write(body[pos:])
+
+	return out.Bytes(), ret, nil
+}
+
+// Restore replaces the placeholders of shortcodes in buf, the converted body
+// of the document, with the rendered shortcodes. Placeholders which make up a
+// whole paragraph are replaced along with the paragraph tags.
+func (s *Shortcodes) Restore(buf []byte) []byte {
+	for i, x := range s.expansions {
+		p := []byte(placeholder(i))
+		buf = bytes.ReplaceAll(buf, append(append([]byte("<p>"), p...),
+			"</p>"...), x)
+		buf = bytes.ReplaceAll(buf, p, x)
+	}
+
+	return buf
+}
+
+func placeholder(i int) string {
+	return fmt.Sprintf("PPSC%dCSPP", i)
+}
+
+// expansion is the state of the expansion of the shortcodes of a document.
+type expansion struct {
+	file string
+	body []byte
+	line int
+	data map[string]any
+	code [][2]int // offsets of code blocks and spans, see code
+}
+
+// code returns the start and end offsets of the fenced code blocks and code
+// spans of body, in order. Fences are recognised like include directives
+// are, see the documents package, and code spans are delimited by backtick
+// runs of the same length.
+func code(body []byte) [][2]int {
+	ret := [][2]int{}
+
+	fence, start, text := "", 0, 0
+	pos := 0
+
+	for _, l := range bytes.SplitAfter(body, []byte{'\n'}) {
+		line := strings.TrimRight(string(l), "\r\n")
+
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) < 4 {
+			switch {
+			case fence != "" && strings.HasPrefix(trimmed, fence):
+				ret = append(ret, [2]int{start, pos + len(l)})
+				fence, text = "", pos+len(l)
+			case fence == "" && (strings.HasPrefix(trimmed, "```") ||
+				strings.HasPrefix(trimmed, "~~~")):
+				ret = append(ret, spans(body, text, pos)...)
+				fence, start = trimmed[:3], pos
+			}
+		}
+
+		pos += len(l)
+	}
+
+	if fence != "" {
+		return append(ret, [2]int{start, len(body)})
+	}
+
+	return append(ret, spans(body, text, len(body))...)
+}
+
+// spans returns the start and end offsets of the code spans of body between
+// the offsets from and to.
+func spans(body []byte, from, to int) [][2]int {
+	ret := [][2]int{}
+
+	run := func(i int) int {
+		n := 0
+		for i+n < to && body[i+n] == '`' {
+			n++
+		}
+		return n
+	}
+
+	for i := from; i < to; {
+		if body[i] != '`' {
+			i++
+			continue
+		}
+
+		n := run(i)
+		end := -1
+		for j := i + n; j < to && end < 0; {
+			if body[j] != '`' {
+				j++
+				continue
+			}
+
+			m := run(j)
+			if m == n {
+				end = j + m
+			}
+			j += m
+		}
+
+		if end < 0 {
+			i += n
+			continue
+		}
+
+		ret = append(ret, [2]int{i, end})
+		i = end
+	}
+
+	return ret
+}
+
+// inCode reports whether the given offset of the document body is in a code
+// block or span.
+func (x *expansion) inCode(offset int) bool {
+	for _, c := range x.code {
+		if offset >= c[0] && offset < c[1] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shortcode is a shortcode tag, or a node of the tree of shortcodes of a
+// document, once its closing tag, if any, is known.
+type shortcode struct {
+	name    string
+	closing bool
+	closed  bool   // standalone, e.g., {{< toc />}}
+	literal string // for commented out shortcodes
+	params  map[string]any
+	args    []any
+
+	start, end int // offsets of the tag in the document body
+
+	closer   *shortcode // closing tag of paired shortcodes
+	children []*shortcode
+}
+
+// stop returns the offset of the end of the shortcode, including its closing
+// tag, if any.
+func (sc *shortcode) stop() int {
+	if sc.closer != nil {
+		return sc.closer.end
+	}
+
+	return sc.end
+}
+
+// error returns a diagnostics.Error located in the line of the document at
+// the given offset of its body.
+func (x *expansion) error(offset int, format string, args ...any) error {
+	name := x.file
+	if name == "" {
+		name = "-"
+	}
+
+	line := x.line + bytes.Count(x.body[:offset], []byte{'\n'}) + 1
+
+	e := diagnostics.New(diagnostics.KindShortcode, x.file,
+		fmt.Errorf("%s:%d: "+format, append([]any{name, line}, args...)...))
+	e.Line = line
+
+	return e
+}
+
+// parse returns the tree of shortcodes of the document, by pairing opening
+// and closing tags. Opening tags with no closing tag are standalone
+// shortcodes.
+func (x *expansion) parse() ([]*shortcode, error) {
+	type frame struct {
+		sc       *shortcode
+		children []*shortcode
+	}
+
+	root := &frame{}
+	stack := []*frame{root}
+
+	// unwind pops the frames above stack[k], whose shortcodes are standalone,
+	// moving their children to their parents.
+	unwind := func(k int) {
+		for i := len(stack) - 1; i > k; i-- {
+			stack[i-1].children = append(stack[i-1].children,
+				stack[i].children...)
+		}
+		stack = stack[:k+1]
+	}
+
+	for pos := 0; ; {
+		sc, err := x.next(pos)
+		if err != nil {
+			return nil, err
+		}
+		if sc == nil {
+			break
+		}
+		pos = sc.end
+
+		top := stack[len(stack)-1]
+
+		switch {
+		case sc.literal != "" || sc.closed:
+			top.children = append(top.children, sc)
+		case !sc.closing:
+			top.children = append(top.children, sc)
+			stack = append(stack, &frame{sc: sc})
+		default:
+			k := len(stack) - 1
+			for k > 0 && stack[k].sc.name != sc.name {
+				k--
+			}
+
+			if k == 0 {
+				return nil, x.error(sc.start,
+					"closing shortcode %q was not opened", sc.name)
+			}
+
+			unwind(k)
+			stack[k].sc.closer = sc
+			stack[k].sc.children = stack[k].children
+			stack = stack[:k]
+		}
+	}
+
+	unwind(0)
+
+	return root.children, nil
+}
+
+// next returns the first shortcode tag at or after the offset pos of the
+// document body, or nil if there are none, skipping tags in code other than
+// comments.
+func (x *expansion) next(pos int) (*shortcode, error) {
+	i := bytes.Index(x.body[pos:], []byte("{{<"))
+	if i < 0 {
+		return nil, nil
+	}
+
+	start := pos + i
+	rest := x.body[start+3:]
+	t := bytes.TrimLeft(rest, " \t")
+	comment := bytes.HasPrefix(t, []byte("/*"))
+
+	if !comment && x.inCode(start) {
+		return x.next(start + 3)
+	}
+
+	if comment {
+		j := bytes.Index(t, []byte("*/>}}"))
+		if j < 0 {
+			return nil, x.error(start, "unclosed shortcode comment")
+		}
+
+		end := len(x.body) - len(t) + j + 5
+
+		return &shortcode{
+			literal: "{{<" + string(t[2:j]) + ">}}",
+			start:   start,
+			end:     end,
+		}, nil
+	}
+
+	// find the end of the tag, skipping quoted parameters
+	quoted, j := false, 0
+	for ; j < len(rest); j++ {
+		switch {
+		case quoted && rest[j] == '\\':
+			j++
+		case rest[j] == '"':
+			quoted = !quoted
+		case !quoted && bytes.HasPrefix(rest[j:], []byte(">}}")):
+			return x.tag(start, start+3+j+3, string(rest[:j]))
+		}
+	}
+
+	return nil, x.error(start, "unclosed shortcode")
+}
+
+// tag parses the content of the shortcode tag at the given offsets of the
+// document body.
+func (x *expansion) tag(start, end int, s string) (*shortcode, error) {
+	sc := &shortcode{start: start, end: end, params: map[string]any{}}
+
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, " /") || strings.HasSuffix(s, "\t/") {
+		sc.closed = true
+		s = strings.TrimSpace(s[:len(s)-1])
+	}
+
+	if strings.HasPrefix(s, "/") {
+		sc.closing = true
+		s = strings.TrimSpace(s[1:])
+	}
+
+	i := strings.IndexAny(s, " \t\r\n")
+	if i < 0 {
+		i = len(s)
+	}
+	sc.name, s = s[:i], s[i:]
+
+	if sc.name == "" {
+		return nil, x.error(start, "shortcode with no name")
+	}
+
+	for strings.TrimSpace(s) != "" {
+		m := shortcodeParamRegexp.FindStringSubmatch(s)
+		if m == nil {
+			return nil, x.error(start, "shortcode %q: malformed parameters: %s",
+				sc.name, strings.TrimSpace(s))
+		}
+		s = s[len(m[0]):]
+
+		value := m[2]
+		if strings.HasPrefix(value, `"`) {
+			var err error
+			value, err = strconv.Unquote(value)
+			if err != nil {
+				return nil, x.error(start, "shortcode %q: %s: %w",
+					sc.name, m[2], err)
+			}
+		}
+
+		if m[1] == "" {
+			sc.args = append(sc.args, value)
+		} else {
+			sc.params[m[1]] = value
+		}
+	}
+
+	if sc.closing && (len(sc.args) > 0 || len(sc.params) > 0) {
+		return nil, x.error(start,
+			"closing shortcode %q has parameters", sc.name)
+	}
+
+	return sc, nil
+}
+
+// render renders a shortcode with its template.
+func (x *expansion) render(sc *shortcode) ([]byte, error) {
+	if sc.literal != "" {
+		return []byte(sc.literal), nil
+	}
+
+	inner := new(bytes.Buffer)
+	if sc.closer != nil {
+		pos := sc.end
+		for _, child := range sc.children {
+			inner.Write(x.body[pos:child.start])
+			pos = child.stop()
+
+			buf, err := x.render(child)
+			if err != nil {
+				return nil, err
+			}
+			inner.Write(buf)
+		}
+		inner.Write(x.body[pos:sc.closer.start])
+	}
+
+	t, err := loadShortcode(sc.name)
+	if err != nil {
+		return nil, x.error(sc.start, "%w", err)
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = t.Apply(buf, map[string]any{
+		"name":   sc.name,
+		"params": sc.params,
+		"args":   sc.args,
+		"inner":  inner.String(),
+		"page":   x.data,
+	})
+	if err != nil {
+		return nil, x.error(sc.start, "shortcode %q: %w", sc.name, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// loadShortcode returns the template of the named shortcode, parsing it if
+// not yet cached.
+func loadShortcode(name string) (*Template, error) {
+	var p string
+
+	for _, dir := range ShortcodePath {
+		for _, ext := range []string{".html", ".txt"} {
+			f := filepath.Join(dir, name+ext)
+			if info, err := os.Stat(f); err == nil && !info.IsDir() {
+				p = f
+				break
+			}
+		}
+
+		if p != "" {
+			break
+		}
+	}
+
+	if len(ShortcodePath) == 0 {
+		return nil, fmt.Errorf("shortcode %q not found, no shortcode "+
+			"directory configured", name)
+	}
+
+	if p == "" {
+		return nil, fmt.Errorf("shortcode %q not found in %s",
+			name, strings.Join(ShortcodePath, ", "))
+	}
+
+	shortcodeTemplates.mutex.Lock()
+	defer shortcodeTemplates.mutex.Unlock()
+
+	if ret, ok := shortcodeTemplates.templates[p]; ok {
+		return ret, nil
+	}
+
+	ret, _, err := FromFile(p)
+	if err != nil {
+		return nil, err
+	}
+	shortcodeTemplates.templates[p] = ret
+
+	return ret, nil
+}
@@ -0,0 +1,142 @@
+package templates_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cdop.pt/go/free/platepipe/diagnostics"
+	"cdop.pt/go/free/platepipe/documents"
+	"cdop.pt/go/free/platepipe/templates"
+	. "cdop.pt/go/open/assertive"
+)
+
+func TestShortcodes(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, content string) {
+		p := filepath.Join(dir, name)
+		Need(t, os.WriteFile(p, []byte(content), 0o600) == nil)
+	}
+
+	write("figure.html", `<figure><img src="{{ .params.src }}">`+
+		`<figcaption>{{ .params.caption }}</figcaption></figure>`)
+	write("note.html", `<aside class="{{ index .args 0 }}">`+
+		`{{ markdownify .inner }}</aside>`)
+	write("ver.txt", `{{ .page.release }}`)
+	write("fail.txt", `{{ index .args 5 }}`)
+
+	templates.ShortcodePath = []string{dir}
+	defer func() { templates.ShortcodePath = nil }()
+
+	data := map[string]any{"release": "v1"}
+
+	convert := func(body string) (string, error) {
+		buf, s, err := templates.ExpandShortcodes("doc.md", []byte(body), 2, data)
+		if err != nil {
+			return "", err
+		}
+
+		html, err := documents.MarkdownToHTML(nil, "doc.md", buf)
+		Need(t, err == nil)
+
+		return string(s.Restore(html)), nil
+	}
+
+	cases := []struct {
+		name string
+		body string
+		html string
+	}{
+		{
+			"none",
+			"*text*",
+			"<p><em>text</em></p>\n",
+		},
+		{
+			"block",
+			`{{< figure src="a b.png" caption="<A & B>" >}}`,
+			`<figure><img src="a%20b.png">` +
+				`<figcaption>&lt;A &amp; B&gt;</figcaption></figure>` + "\n",
+		},
+		{
+			"inline",
+			"Version {{< ver />}} *out*",
+			"<p>Version v1 <em>out</em></p>\n",
+		},
+		{
+			"paired",
+			"{{< note warning >}}\n*Beware* of {{< ver >}}\n{{< /note >}}",
+			`<aside class="warning"><p><em>Beware</em> of v1</p>` +
+				"\n</aside>\n",
+		},
+		{
+			"commented out",
+			"`{{</* figure */>}}`",
+			"<p><code>{{&lt; figure &gt;}}</code></p>\n",
+		},
+		{
+			"code span",
+			"``{{< ver >}}`` {{< ver >}}",
+			"<p><code>{{&lt; ver &gt;}}</code> v1</p>\n",
+		},
+		{
+			"fenced code",
+			"```\n{{< ver >}}\n```\n\n{{< ver >}}",
+			"<pre><code>{{&lt; ver &gt;}}\n</code></pre>\nv1\n",
+		},
+		{
+			"unclosed fence",
+			"{{< ver >}}\n~~~\n{{< nope >}}",
+			"v1\n<pre><code>{{&lt; nope &gt;}}</code></pre>\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			html, err := convert(c.body)
+
+			Need(t, err == nil)
+			Want(t, html == c.html)
+		})
+	}
+
+	errs := []struct {
+		name string
+		body string
+		line int
+		msg  string
+	}{
+		{"unknown", "a\n\n{{< nope >}}", 5,
+			`doc.md:5: shortcode "nope" not found in ` + dir},
+		{"unclosed", "{{< ver", 3, "doc.md:3: unclosed shortcode"},
+		{"not opened", "\n{{< /note >}}", 4,
+			`doc.md:4: closing shortcode "note" was not opened`},
+		{"template", "\n\n{{< fail >}}", 5, `doc.md:5: shortcode "fail": `},
+	}
+
+	for _, c := range errs {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := convert(c.body)
+
+			var d *diagnostics.Error
+			Need(t, errors.As(err, &d))
+			Want(t, d.Kind == diagnostics.KindShortcode)
+			Want(t, d.File == "doc.md")
+			Want(t, d.Line == c.line)
+			Want(t, strings.HasPrefix(err.Error(), c.msg))
+		})
+	}
+
+	t.Run("no shortcode directory", func(t *testing.T) {
+		templates.ShortcodePath = nil
+		defer func() { templates.ShortcodePath = []string{dir} }()
+
+		html, err := convert("{{< nope >}}")
+
+		Need(t, err == nil)
+		Want(t, html == "<p>{{&lt; nope &gt;}}</p>\n")
+	})
+}
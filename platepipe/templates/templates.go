@@ -5,20 +5,61 @@
 //
 // For details on the formats and processing of the metadata headers, see the
 // documentation for the metadata package.
+//
+// Errors returned by this package are *diagnostics.Error values, located in
+// the template's source file.
+//
+// Some metadata header keys configure the template they belong to, in
+// addition to being template variables:
+//
+//	strict = true             # or false, overrides the Strict variable
+//	requires.title = "string" # expected variables, see Requirement
+//	layout = "base.html"      # layout file the template extends
+//
+// Layouts are templates which the template extends by overriding the blocks
+// they define, in the same way as the standard library template packages
+// allow, but across files. The template and its layouts are parsed into a
+// single set of associated templates, starting with the outermost layout,
+// which is the one executed, so that templates defined in the template
+// replace the ones defined in the layouts. For example, a template may
+// override {{ block "main" . }}default{{ end }}, defined in its layout, with
+// {{ define "main" }}...{{ end }}. Anything outside of define actions in the
+// template itself is not rendered. Layout files are looked up like partials,
+// see SearchPath, and may extend other layouts. Layout headers define
+// variables too, with lower priority than those of the template, but their
+// settings, such as strict, do not apply.
 package templates
 
 import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	htemplate "html/template"
 	ttemplate "text/template"
 
+	"cdop.pt/go/free/platepipe/diagnostics"
 	"cdop.pt/go/free/platepipe/documents"
 	"cdop.pt/go/free/platepipe/documents/files"
+	"cdop.pt/go/free/platepipe/variables"
 )
 
+// Strict makes templates fail when rendering references a missing map key,
+// i.e., an undefined variable, instead of rendering "<no value>" or an empty
+// string. Templates can override it with the "strict" key in their metadata
+// header.
+//
+// Strict mode applies to every access to a missing key, including the ones in
+// conditions, such as {{ if .key }}. Use {{ if index . "key" }} to test for
+// optional variables.
+//
+// Changing this setting should be done before loading templates.
+var Strict bool
+
 // FromFile loads a text or HTML template from a file whose path is passed as
 // the argument.
 //
@@ -35,84 +76,209 @@ func FromFile(file string) (*Template, map[string]any, error) {
 
 // HTMLTemplateFromFile loads an html/template and its metadata (if any) from
 // the given file.
+//
+// The template is named after the file, so that parse and execution errors
+// refer to it by its path and to lines in the original file.
 func HTMLTemplateFromFile(file string) (*Template, map[string]any, error) {
-	buf, data, err := documents.FromTextFile(file)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	t, err := newHTMLTemplate(buf)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return t, data, nil
+	return fromFile(file, newHTMLTemplate)
 }
 
 // HTMLTemplateFromStream loads an html/template and its metadata (if any) from
 // the given io.Reader.
 func HTMLTemplateFromStream(r io.Reader) (*Template, map[string]any, error) {
-	buf, data, err := documents.FromTextStream(r)
+	return fromStream("", r, newHTMLTemplate)
+}
+
+// TextTemplateFromFile loads an html/template and its metadata (if any) from
+// the given file.
+//
+// The template is named after the file, so that parse and execution errors
+// refer to it by its path and to lines in the original file.
+func TextTemplateFromFile(file string) (*Template, map[string]any, error) {
+	return fromFile(file, newTextTemplate)
+}
+
+// TextTemplateFromStream loads an html/template and its metadata (if any) from
+// the given io.Reader.
+func TextTemplateFromStream(r io.Reader) (*Template, map[string]any, error) {
+	return fromStream("", r, newTextTemplate)
+}
+
+// constructor parses the given parts, a template and its layouts, with one of
+// the standard library template packages into t, configured according to the
+// metadata header of the template, the last part.
+type constructor func(t *Template, parts []part) error
+
+func fromFile(file string, newTemplate constructor) (
+	*Template, map[string]any, error,
+) {
+	r, err := os.Open(file)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, diagnostics.New(diagnostics.KindIO, file, err)
 	}
+	defer r.Close()
 
-	t, err := newHTMLTemplate(buf)
+	return fromStream(file, r, newTemplate)
+}
+
+// fromStream reads a template and its metadata from r. Templates not read from
+// a file are named after a hash of their content.
+func fromStream(file string, r io.Reader, newTemplate constructor) (
+	*Template, map[string]any, error,
+) {
+	buf, err := io.ReadAll(r)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, diagnostics.New(diagnostics.KindIO, file, err)
 	}
 
-	return t, data, nil
-}
+	content, data, line := documents.Split(buf)
 
-// TextTemplateFromFile loads an html/template and its metadata (if any) from
-// the given file.
-func TextTemplateFromFile(file string) (*Template, map[string]any, error) {
-	buf, data, err := documents.FromTextFile(file)
+	src := source{file, file, line}
+	if file == "" {
+		src.name = hash(content)
+	}
+
+	parts, err := loadLayouts(part{src, content, data})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	t, err := newTextTemplate(buf)
+	t := &Template{
+		source:     src,
+		deps:       map[string]bool{},
+		keySources: map[string]source{},
+	}
+
+	headers := []map[string]any{}
+	for i := len(parts) - 1; i >= 0; i-- {
+		requires, err := parseRequirements(parts[i].data)
+		if err != nil {
+			return nil, nil, diagnostics.New(diagnostics.KindMetadata,
+				parts[i].file, fmt.Errorf("%s: %w", parts[i].name, err))
+		}
+
+		t.requires = append(t.requires, requires...)
+		headers = append(headers, parts[i].data)
+
+		for k := range parts[i].data {
+			if _, ok := t.keySources[k]; !ok {
+				t.keySources[k] = parts[i].source
+			}
+		}
+
+		if i != len(parts)-1 {
+			t.layouts = append(t.layouts, parts[i].source)
+			t.deps[parts[i].file] = true
+		}
+	}
+
+	err = newTemplate(t, parts)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	data = variables.Coalesce(headers...)
+	for k := range data {
+		t.keys = append(t.keys, k)
+	}
+	sort.Strings(t.keys)
+
 	return t, data, nil
 }
 
-// TextTemplateFromStream loads an html/template and its metadata (if any) from
-// the given io.Reader.
-func TextTemplateFromStream(r io.Reader) (*Template, map[string]any, error) {
-	buf, data, err := documents.FromTextStream(r)
-	if err != nil {
-		return nil, nil, err
+func newHTMLTemplate(t *Template, parts []part) error {
+	t.newPartial, t.partials = newHTMLTemplate, htmlPartials
+
+	partials := htemplate.FuncMap{}
+	for i, p := range parts {
+		from := p.file
+		partials[partialFunc(parts, i)] = func(
+			name string, data any,
+		) (htemplate.HTML, error) {
+			ret, err := t.partial(name, from, data)
+			return htemplate.HTML(ret), err
+		}
 	}
 
-	t, err := newTextTemplate(buf)
-	if err != nil {
-		return nil, nil, err
+	root := htemplate.New(parts[0].name).
+		Option(missingKeyOption(parts[len(parts)-1].data)).
+		Funcs(htemplate.FuncMap(Funcs)).
+		Funcs(htemplate.FuncMap(htmlFuncs)).
+		Funcs(partials)
+
+	for i, p := range parts {
+		tpl := root
+		if i > 0 {
+			tpl = root.New(p.name)
+		}
+
+		_, err := tpl.Parse(string(p.body))
+		if err != nil {
+			return t.error(diagnostics.KindTemplateParse, err)
+		}
 	}
 
-	return t, data, nil
+	for _, tpl := range root.Templates() {
+		renamePartials(tpl.Tree, parts)
+	}
+
+	t.stdTemplate = root
+
+	return nil
 }
 
-func newHTMLTemplate(buf []byte) (*Template, error) {
-	t, err := htemplate.New(hash(buf)).Parse(string(buf))
-	if err != nil {
-		return nil, err
+func newTextTemplate(t *Template, parts []part) error {
+	t.newPartial, t.partials = newTextTemplate, textPartials
+
+	partials := ttemplate.FuncMap{}
+	for i, p := range parts {
+		from := p.file
+		partials[partialFunc(parts, i)] = func(
+			name string, data any,
+		) (string, error) {
+			return t.partial(name, from, data)
+		}
+	}
+
+	root := ttemplate.New(parts[0].name).
+		Option(missingKeyOption(parts[len(parts)-1].data)).
+		Funcs(ttemplate.FuncMap(Funcs)).
+		Funcs(partials)
+
+	for i, p := range parts {
+		tpl := root
+		if i > 0 {
+			tpl = root.New(p.name)
+		}
+
+		_, err := tpl.Parse(string(p.body))
+		if err != nil {
+			return t.error(diagnostics.KindTemplateParse, err)
+		}
 	}
 
-	return &Template{t}, nil
+	for _, tpl := range root.Templates() {
+		renamePartials(tpl.Tree, parts)
+	}
+
+	t.stdTemplate = root
+
+	return nil
 }
 
-func newTextTemplate(buf []byte) (*Template, error) {
-	t, err := ttemplate.New(hash(buf)).Parse(string(buf))
-	if err != nil {
-		return nil, err
+// missingKeyOption returns the template option that implements the strict
+// mode setting, taken from the metadata header or the Strict variable.
+func missingKeyOption(data map[string]any) string {
+	strict := Strict
+	if v, ok := data["strict"].(bool); ok {
+		strict = v
 	}
 
-	return &Template{t}, nil
+	if strict {
+		return "missingkey=error"
+	}
+
+	return "missingkey=default"
 }
 
 func hash(buf []byte) string {
@@ -125,9 +291,37 @@ type Template struct {
 	stdTemplate interface {
 		Execute(io.Writer, any) error
 	}
+
+	source
+	layouts []source // from the innermost to the outermost
+
+	requires []Requirement
+	keys     []string // metadata header keys, sorted
+
+	// keySources holds the innermost of the template and its layouts
+	// declaring each metadata header key
+	keySources map[string]source
+
+	newPartial constructor     // parses partials with the same package
+	partials   *partialCache   // partials parsed by newPartial
+	depsMutex  sync.Mutex      // guards deps, partials may run concurrently
+	deps       map[string]bool // files of the partials used when rendering
+	depth      atomic.Int32    // renderings of the template as a partial
+}
+
+// Name returns the name of the template, used in error messages, which is
+// the path of its file, when loaded from a file.
+func (t *Template) Name() string {
+	return t.name
 }
 
 // Apply renders the template, with the provided data, to an io.Writer.
+//
+// Errors are returned as *diagnostics.Error values.
 func (t *Template) Apply(w io.Writer, data map[string]any) error {
-	return t.stdTemplate.Execute(w, data)
+	return t.execute(w, data)
+}
+
+func (t *Template) execute(w io.Writer, data any) error {
+	return t.error(diagnostics.KindTemplateExec, t.stdTemplate.Execute(w, data))
 }
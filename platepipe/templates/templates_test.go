@@ -2,11 +2,17 @@ package templates_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"testing/iotest"
+	"time"
 
+	"cdop.pt/go/free/platepipe/diagnostics"
 	"cdop.pt/go/free/platepipe/templates"
 	. "cdop.pt/go/open/assertive"
 )
@@ -210,6 +216,225 @@ func TestTemplateApplication(t *testing.T) {
 	})
 }
 
+func TestErrorLocations(t *testing.T) {
+	t.Run("parse error in text template", func(t *testing.T) {
+		f := mkTestFile(t, "parse-error-*.txt",
+			"key = 'value'\nother = 1\n\nline 4\nline 5 {{ .key")
+		defer os.Remove(f)
+
+		_, _, err := templates.FromFile(f)
+
+		Need(t, err != nil)
+		Want(t, strings.HasPrefix(err.Error(), "template: "+f+":5: "))
+
+		var d *diagnostics.Error
+		Need(t, errors.As(err, &d))
+		Want(t, d.Kind == diagnostics.KindTemplateParse)
+		Want(t, d.File == f)
+		Want(t, d.Line == 5)
+	})
+
+	t.Run("parse error in html template", func(t *testing.T) {
+		f := mkTestFile(t, "parse-error-*.html",
+			"key = 'value'\n\n<p>\n{{ end }}</p>")
+		defer os.Remove(f)
+
+		_, _, err := templates.FromFile(f)
+
+		Need(t, err != nil)
+		Want(t, strings.HasPrefix(err.Error(), "template: "+f+":4: "))
+	})
+
+	t.Run("exec error in text template", func(t *testing.T) {
+		f := mkTestFile(t, "exec-error-*.txt",
+			"key = 'value'\n\nline 3\n{{ .key.field }}")
+		defer os.Remove(f)
+
+		tpl, data, err := templates.FromFile(f)
+		Need(t, err == nil)
+
+		err = tpl.Apply(io.Discard, data)
+
+		Need(t, err != nil)
+		Want(t, strings.HasPrefix(err.Error(), "template: "+f+":4:7: "))
+
+		var d *diagnostics.Error
+		Need(t, errors.As(err, &d))
+		Want(t, d.Kind == diagnostics.KindTemplateExec)
+		Want(t, d.File == f)
+		Want(t, d.Line == 4)
+		Want(t, d.Column == 7)
+	})
+
+	t.Run("exec error without header", func(t *testing.T) {
+		f := mkTestFile(t, "exec-error-*.txt", "\n{{ .key.field }}")
+		defer os.Remove(f)
+
+		tpl, _, err := templates.FromFile(f)
+		Need(t, err == nil)
+
+		err = tpl.Apply(io.Discard, map[string]any{"key": 1})
+
+		Need(t, err != nil)
+		Want(t, strings.HasPrefix(err.Error(), "template: "+f+":2:7: "))
+	})
+
+	t.Run("names ending with other names", func(t *testing.T) {
+		dir := t.TempDir()
+		Need(t, os.WriteFile(filepath.Join(dir, "base.html"),
+			[]byte("k = 1\n\n{{ block \"main\" . }}{{ end }}"), 0o600) == nil)
+		Need(t, os.WriteFile(filepath.Join(dir, "mybase.html"),
+			[]byte("layout = 'base.html'\na = 1\n\n{{ define \"main\" }}\n"+
+				"{{ .a.field }}{{ end }}"), 0o600) == nil)
+
+		wd, err := os.Getwd()
+		Need(t, err == nil)
+		Need(t, os.Chdir(dir) == nil)
+		defer os.Chdir(wd)
+
+		tpl, data, err := templates.FromFile("mybase.html")
+		Need(t, err == nil)
+
+		err = tpl.Apply(io.Discard, data)
+
+		Need(t, err != nil)
+		Want(t, strings.HasPrefix(err.Error(),
+			"template: mybase.html:5:5: "))
+
+		var d *diagnostics.Error
+		Need(t, errors.As(err, &d))
+		Want(t, d.File == "mybase.html")
+		Want(t, d.Line == 5 && d.Column == 5)
+	})
+}
+
+func TestStrictMode(t *testing.T) {
+	cases := []struct {
+		name    string
+		pattern string
+		header  string
+		strict  bool
+		fails   bool
+	}{
+		{"lenient text", "*.txt", "", false, false},
+		{"lenient html", "*.html", "", false, false},
+		{"strict text", "*.txt", "", true, true},
+		{"strict html", "*.html", "", true, true},
+		{"strict text header", "*.txt", "strict = true\n\n", false, true},
+		{"strict html header", "*.html", "strict = true\n\n", false, true},
+		{"lenient text header", "*.txt", "strict = false\n\n", true, false},
+		{"lenient html header", "*.html", "strict = false\n\n", true, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f := mkTestFile(t, "strict-"+c.pattern, c.header+"{{ .missing }}")
+			defer os.Remove(f)
+
+			templates.Strict = c.strict
+			defer func() { templates.Strict = false }()
+
+			tpl, _, err := templates.FromFile(f)
+			Need(t, err == nil)
+
+			err = tpl.Apply(io.Discard, map[string]any{})
+
+			Want(t, (err != nil) == c.fails)
+			if err != nil {
+				Want(t, strings.Contains(err.Error(), f+":"))
+				Want(t, strings.HasSuffix(err.Error(),
+					`map has no entry for key "missing"`))
+			}
+		})
+	}
+}
+
+func TestRequirements(t *testing.T) {
+	t.Run("bad declarations", func(t *testing.T) {
+		headers := []string{
+			"requires = 'string'\n\n",
+			"requires.key = 1\n\n",
+			"requires.key = 'text'\n\n",
+			"requires.key = { default = 1 }\n\n",
+		}
+
+		for _, h := range headers {
+			r := bytes.NewBuffer([]byte(h + "{{ .key }}"))
+
+			_, _, err := templates.TextTemplateFromStream(r)
+
+			var d *diagnostics.Error
+			Need(t, errors.As(err, &d))
+			Want(t, d.Kind == diagnostics.KindMetadata)
+		}
+	})
+
+	t.Run("first bad declaration", func(t *testing.T) {
+		header := ""
+		for c := 'z'; c >= 'a'; c-- {
+			header += fmt.Sprintf("requires.%c = 'text'\n", c)
+		}
+
+		r := bytes.NewBufferString(header + "\n{{ .a }}")
+
+		_, _, err := templates.TextTemplateFromStream(r)
+		Need(t, err != nil)
+		Want(t, strings.Contains(err.Error(), `requirement "a"`))
+	})
+
+	t.Run("declarations", func(t *testing.T) {
+		r := bytes.NewBuffer([]byte("key = 1\n[requires]\n" +
+			"title = 'string'\ntags = 'array?'\n" +
+			"lang = { type = 'string', default = 'en' }\n\n{{ .title }}"))
+
+		tpl, _, err := templates.TextTemplateFromStream(r)
+
+		Need(t, err == nil)
+		Want(t, fmt.Sprint(tpl.Requirements()) == fmt.Sprint(
+			[]templates.Requirement{
+				{Name: "lang", Type: "string", Optional: true, Default: "en"},
+				{Name: "tags", Type: "array", Optional: true},
+				{Name: "title", Type: "string"},
+			}))
+	})
+
+	t.Run("check", func(t *testing.T) {
+		r1 := bytes.NewBuffer([]byte("key = 1\n[requires]\n" +
+			"title = 'string'\ncount = 'integer'\ntags = 'array?'\n\n"))
+		r2 := bytes.NewBuffer([]byte("key = 2\n[requires]\n" +
+			"date = 'datetime'\nratio = 'number'\n" +
+			"lang = { type = 'string', default = 'en' }\n\n"))
+
+		t1, _, err := templates.TextTemplateFromStream(r1)
+		Need(t, err == nil)
+		t2, _, err := templates.TextTemplateFromStream(r2)
+		Need(t, err == nil)
+
+		data := map[string]any{
+			"title": "ok",
+			"count": "not an integer",
+			"tags":  []string{"a"},
+			"ratio": 1,
+		}
+
+		err = templates.CheckRequirements(data, t1, t2)
+
+		Need(t, err != nil)
+		errs := err.(interface{ Unwrap() []error }).Unwrap()
+		Need(t, len(errs) == 2)
+		Want(t, strings.HasSuffix(errs[0].Error(),
+			`variable "count" must be of type integer, not string`))
+		Want(t, strings.HasSuffix(errs[1].Error(),
+			`missing required variable "date" of type datetime`))
+		Want(t, data["lang"] == "en")
+
+		data["count"] = int64(3)
+		data["date"] = time.Now()
+
+		Want(t, templates.CheckRequirements(data, t1, t2) == nil)
+	})
+}
+
 func mkTestFile(t *testing.T, pattern, content string) string {
 	f, err := os.CreateTemp("", pattern)
 	Need(t, err == nil)